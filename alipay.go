@@ -0,0 +1,84 @@
+package qsign
+
+import (
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha1" // register hashes for crypto.Hash.New
+	_ "crypto/sha256"
+	"fmt"
+	"net/url"
+)
+
+// Sign types of Alipay APIs, given by parameter "sign_type".
+const (
+	AlipaySignTypeRSA  = "RSA"
+	AlipaySignTypeRSA2 = "RSA2"
+)
+
+// NewAlipay returns a *Qsign signing request parameters of Alipay APIs with the merchant
+// private key. Parameter "sign" and parameters with empty values are excluded from the
+// digest. The digest is signed by SHA256withRSA for sign type "RSA2", or SHA1withRSA for
+// sign type "RSA", and encoded as base64.
+func NewAlipay(signType string, privateKey *rsa.PrivateKey) (*Qsign, error) {
+	hash, err := alipayHash(signType)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewQsign(Options{
+		Filter: func(key, value string) bool {
+			return key != "sign" && len(value) > 0
+		},
+		Encoder: base64Encoder,
+		Hasher:  hash.New,
+		Signer:  NewRSASigner(privateKey, hash),
+	}), nil
+}
+
+// NewAlipayNotify returns a *Qsign verifying parameters of Alipay async notifies with the
+// Alipay public key. Parameters "sign", "sign_type" and parameters with empty values are
+// excluded from the digest.
+func NewAlipayNotify(signType string, publicKey *rsa.PublicKey) (*Qsign, error) {
+	hash, err := alipayHash(signType)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewQsign(Options{
+		Filter: func(key, value string) bool {
+			return key != "sign" && key != "sign_type" && len(value) > 0
+		},
+		Encoder:  base64Encoder,
+		Hasher:   hash.New,
+		Verifier: NewRSAVerifier(publicKey, hash),
+	}), nil
+}
+
+// VerifyAlipayNotify verifies form, the parameters posted by an Alipay async notify, with the
+// Alipay public key. The sign type and signature are taken from parameter "sign_type" and
+// "sign".
+func VerifyAlipayNotify(publicKey *rsa.PublicKey, form url.Values) error {
+	q, err := NewAlipayNotify(form.Get("sign_type"), publicKey)
+	if err != nil {
+		return err
+	}
+
+	params := make(map[string]string, len(form))
+	for k := range form {
+		params[k] = form.Get(k)
+	}
+
+	return q.Verify(params, []byte(form.Get("sign")))
+}
+
+// alipayHash returns the hash used by Alipay sign type signType.
+func alipayHash(signType string) (crypto.Hash, error) {
+	switch signType {
+	case AlipaySignTypeRSA2:
+		return crypto.SHA256, nil
+	case AlipaySignTypeRSA:
+		return crypto.SHA1, nil
+	default:
+		return 0, &FieldError{Path: "sign_type", Err: fmt.Errorf("unsupported Alipay sign type %q", signType)}
+	}
+}
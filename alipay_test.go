@@ -0,0 +1,123 @@
+package qsign
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+type alipayTradePay struct {
+	AppID      string `form:"app_id"`
+	Method     string `form:"method"`
+	Charset    string `form:"charset"`
+	SignType   string `form:"sign_type"`
+	Timestamp  string `form:"timestamp"`
+	Version    string `form:"version"`
+	BizContent string `form:"biz_content"`
+	NotifyURL  string `form:"notify_url"`
+	Sign       string `form:"sign"`
+}
+
+func TestAlipaySign(t *testing.T) {
+	key := testRSAKey(t)
+
+	req := alipayTradePay{
+		AppID:      "2014072300007148",
+		Method:     "alipay.trade.pay",
+		Charset:    "utf-8",
+		Timestamp:  "2014-07-24 03:07:50",
+		Version:    "1.0",
+		BizContent: `{"out_trade_no":"20150320010101001","total_amount":"88.88","subject":"Iphone6 16G"}`,
+		Sign:       "ignored",
+	}
+	digest := `app_id=2014072300007148&biz_content={"out_trade_no":"20150320010101001","total_amount":"88.88","subject":"Iphone6 16G"}&charset=utf-8&method=alipay.trade.pay&sign_type=%s&timestamp=2014-07-24 03:07:50&version=1.0`
+
+	cases := []struct {
+		signType string
+		hash     crypto.Hash
+		sum      func(string) []byte
+	}{
+		{AlipaySignTypeRSA2, crypto.SHA256, func(s string) []byte { h := sha256.Sum256([]byte(s)); return h[:] }},
+		{AlipaySignTypeRSA, crypto.SHA1, func(s string) []byte { h := sha1.Sum([]byte(s)); return h[:] }},
+	}
+
+	for _, c := range cases {
+		req.SignType = c.signType
+
+		q, err := NewAlipay(c.signType, key)
+		if err != nil {
+			t.Fatalf("expect no error, actual %v", err)
+		}
+
+		d, err := q.Sign(req)
+		if err != nil {
+			t.Fatalf("expect no error, actual %v", err)
+		}
+
+		signature, err := base64.StdEncoding.DecodeString(string(d))
+		if err != nil {
+			t.Fatalf("expect signature is base64 encoded, actual %v", err)
+		}
+
+		sum := c.sum(fmt.Sprintf(digest, c.signType))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, c.hash, sum, signature); err != nil {
+			t.Errorf("expect sign type %s signature is valid, actual %v", c.signType, err)
+		}
+	}
+
+	if _, err := NewAlipay("MD5", key); err == nil {
+		t.Errorf("expect unsupported sign type returns an error")
+	}
+}
+
+func TestAlipayVerifyNotify(t *testing.T) {
+	key := testRSAKey(t)
+
+	form := url.Values{
+		"notify_time":    {"2015-04-27 15:45:57"},
+		"notify_type":    {"trade_status_sync"},
+		"notify_id":      {"4a91b7a78a503640467525113fb7d8bg8e"},
+		"app_id":         {"2014072300007148"},
+		"charset":        {"utf-8"},
+		"version":        {"1.0"},
+		"sign_type":      {AlipaySignTypeRSA2},
+		"trade_no":       {"2013112011001004330000121536"},
+		"out_trade_no":   {"6823789339978248"},
+		"trade_status":   {"TRADE_SUCCESS"},
+		"total_amount":   {"20.00"},
+		"buyer_logon_id": {""},
+	}
+	digest := "app_id=2014072300007148&charset=utf-8&notify_id=4a91b7a78a503640467525113fb7d8bg8e&notify_time=2015-04-27 15:45:57&notify_type=trade_status_sync&out_trade_no=6823789339978248&total_amount=20.00&trade_no=2013112011001004330000121536&trade_status=TRADE_SUCCESS&version=1.0"
+
+	sum := sha256.Sum256([]byte(digest))
+	signature, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	form.Set("sign", base64.StdEncoding.EncodeToString(signature))
+
+	if err := VerifyAlipayNotify(&key.PublicKey, form); err != nil {
+		t.Errorf("expect notify is verified, actual %v", err)
+	}
+
+	form.Set("total_amount", "0.01")
+	if err := VerifyAlipayNotify(&key.PublicKey, form); err != ErrSignatureMismatch {
+		t.Errorf("expect signature mismatch, actual %v", err)
+	}
+	form.Set("total_amount", "20.00")
+
+	form.Set("sign", "not base64")
+	if err := VerifyAlipayNotify(&key.PublicKey, form); err != ErrSignatureMismatch {
+		t.Errorf("expect signature mismatch, actual %v", err)
+	}
+
+	form.Set("sign_type", "MD5")
+	if err := VerifyAlipayNotify(&key.PublicKey, form); err == nil {
+		t.Errorf("expect unsupported sign type returns an error")
+	}
+}
@@ -0,0 +1,93 @@
+package qsign
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"hash"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AliyunRPC signs requests of Aliyun RPC style (POP) APIs using HMAC-SHA1.
+type AliyunRPC struct {
+	accessKeyID string
+	q           *Qsign
+
+	// now and nonce generate parameters "Timestamp" and "SignatureNonce", replaced in tests.
+	now   func() time.Time
+	nonce func() (string, error)
+}
+
+// NewAliyunRPC returns a *AliyunRPC signing requests with the access key.
+func NewAliyunRPC(accessKeyID, accessKeySecret string) *AliyunRPC {
+	key := []byte(accessKeySecret + "&")
+
+	return &AliyunRPC{
+		accessKeyID: accessKeyID,
+		q: NewQsign(Options{
+			Hasher: func() hash.Hash {
+				return hmac.New(sha1.New, key)
+			},
+			Encoder: base64Encoder,
+		}),
+		now:   time.Now,
+		nonce: randomUUID,
+	}
+}
+
+// Sign returns a copy of params with common parameters and parameter "Signature" added, for
+// a request sent with HTTP method method.
+//
+// Parameters "AccessKeyId", "SignatureMethod" and "SignatureVersion" are always set. If
+// params has no "Timestamp" or "SignatureNonce", the current time in ISO 8601 and a random
+// nonce are injected. The string to sign is "METHOD&%2F&" followed by the RFC 3986 escaped
+// canonical query of the parameters, so the query is escaped twice.
+func (a *AliyunRPC) Sign(method string, params url.Values) (url.Values, error) {
+	signed := make(url.Values, len(params)+6)
+	for k, vs := range params {
+		signed[k] = append([]string{}, vs...)
+	}
+	signed.Del("Signature")
+
+	signed.Set("AccessKeyId", a.accessKeyID)
+	signed.Set("SignatureMethod", "HMAC-SHA1")
+	signed.Set("SignatureVersion", "1.0")
+
+	if len(signed.Get("Timestamp")) == 0 {
+		signed.Set("Timestamp", a.now().UTC().Format("2006-01-02T15:04:05Z"))
+	}
+
+	if len(signed.Get("SignatureNonce")) == 0 {
+		nonce, err := a.nonce()
+		if err != nil {
+			return nil, err
+		}
+		signed.Set("SignatureNonce", nonce)
+	}
+
+	stringToSign := strings.ToUpper(method) + "&" + escapeRFC3986("/") + "&" + escapeRFC3986(CanonicalQuery(signed))
+
+	signature, err := a.q.SignBytes([]byte(stringToSign))
+	if err != nil {
+		return nil, err
+	}
+	signed.Set("Signature", string(signature))
+
+	return signed, nil
+}
+
+// randomUUID returns a random version 4 UUID.
+func randomUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	s := hex.EncodeToString(b[:])
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:], nil
+}
@@ -0,0 +1,84 @@
+package qsign
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestAliyunRPCSign(t *testing.T) {
+	// sample from Aliyun ECS API documentation
+	a := NewAliyunRPC("testid", "testsecret")
+	a.now = func() time.Time {
+		return time.Date(2016, 2, 23, 20, 46, 24, 0, time.FixedZone("CST", 8*3600))
+	}
+	a.nonce = func() (string, error) {
+		return "3ee8c1b8-83d3-44af-a94f-4e0ad82fd6cf", nil
+	}
+
+	params := url.Values{
+		"Action":    {"DescribeRegions"},
+		"Format":    {"XML"},
+		"Version":   {"2014-05-26"},
+		"Signature": {"stale"},
+	}
+
+	signed, err := a.Sign("get", params)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+
+	expect := url.Values{
+		"AccessKeyId":      {"testid"},
+		"Action":           {"DescribeRegions"},
+		"Format":           {"XML"},
+		"SignatureMethod":  {"HMAC-SHA1"},
+		"SignatureNonce":   {"3ee8c1b8-83d3-44af-a94f-4e0ad82fd6cf"},
+		"SignatureVersion": {"1.0"},
+		"Timestamp":        {"2016-02-23T12:46:24Z"},
+		"Version":          {"2014-05-26"},
+		"Signature":        {"OLeaidS1JvxuMvnyHOwuJ+uX5qY="},
+	}
+	if actual, expect := signed.Encode(), expect.Encode(); actual != expect {
+		t.Errorf("expect signed parameters are %s, actual are %s", expect, actual)
+	}
+
+	if actual := params.Get("Signature"); actual != "stale" {
+		t.Errorf("expect input parameters are not changed, actual signature is %s", actual)
+	}
+
+	// given timestamp and nonce are kept
+	params.Set("Timestamp", "2016-02-23T12:46:24Z")
+	params.Set("SignatureNonce", "3ee8c1b8-83d3-44af-a94f-4e0ad82fd6cf")
+	a.now = nil
+	a.nonce = nil
+	if signed, err = a.Sign("GET", params); err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	if actual := signed.Get("Signature"); actual != "OLeaidS1JvxuMvnyHOwuJ+uX5qY=" {
+		t.Errorf("expect signature is OLeaidS1JvxuMvnyHOwuJ+uX5qY=, actual is %s", actual)
+	}
+
+	params.Del("SignatureNonce")
+	a.nonce = func() (string, error) {
+		return "", errors.New("no entropy")
+	}
+	if _, err = a.Sign("GET", params); err == nil {
+		t.Errorf("expect nonce error is returned")
+	}
+}
+
+func TestAliyunRandomUUID(t *testing.T) {
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	a, _ := randomUUID()
+	b, _ := randomUUID()
+	if !pattern.MatchString(a) {
+		t.Errorf("expect %s is a version 4 UUID", a)
+	}
+	if a == b {
+		t.Errorf("expect UUIDs are random, both are %s", a)
+	}
+}
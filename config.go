@@ -0,0 +1,224 @@
+package qsign
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// New is like NewQsign, but returns a *ConfigError if options are invalid or conflict, rather
+// than building a *Qsign producing ambiguous or broken signatures. It checks that:
+//
+//   - options overriding each other, like KeySuffix and SuffixGenerator, Hasher and
+//     KeyedHasher, or KeyResolver and ContextKeyResolver, are not both given, and Delimiter
+//     and Connector are not given with digest modes not using them;
+//   - the digest mode is known;
+//   - the delimiter and the connector are not empty and can be told apart in QueryDigest
+//     mode, and can be escaped in EscapedQueryDigest mode;
+//   - the hasher returns a hash of a non-zero size;
+//   - the encoder writes exactly EncodedLen bytes;
+//   - a Verifier comes with an encoder which can decode signatures;
+//   - keys from a KeyRing or a KeyResolver can be applied by KeySuffix or KeyedHasher, and
+//     KeyRing and KeyResolver are not both given;
+//   - nonces can be generated from NonceLength and NonceAlphabet, which has distinct
+//     characters.
+func New(options Options) (*Qsign, error) {
+	if err := validateOptions(options); err != nil {
+		return nil, err
+	}
+
+	q := NewQsign(options)
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Validate checks the configuration of q, like New does, returning a *ConfigError if it's
+// invalid. Only New validates, so copies derived by With methods like WithDelimiter should be
+// validated by it.
+func (q *Qsign) Validate() error {
+	switch {
+	case q.hasher == nil:
+		return configError("Hasher", "nil hasher")
+	case q.encoder == nil:
+		return configError("Encoder", "nil encoder")
+	case q.filter == nil:
+		return configError("Filter", "nil filter")
+	}
+
+	switch q.mode {
+	case QueryDigest:
+		if err := validateSeparators(q.delimiter, q.connector); err != nil {
+			return err
+		}
+	case EscapedQueryDigest:
+		if err := validateSeparators(q.delimiter, q.connector); err != nil {
+			return err
+		}
+		if strings.ContainsAny(q.delimiter, escapedQueryReserved) {
+			return configError("Delimiter", "delimiter %q can't be escaped", q.delimiter)
+		}
+		if strings.ContainsAny(q.connector, escapedQueryReserved) {
+			return configError("Connector", "connector %q can't be escaped", q.connector)
+		}
+	case CanonicalJSONDigest, LengthPrefixedDigest:
+	default:
+		return configError("DigestMode", "unknown digest mode %d", q.mode)
+	}
+
+	h := q.hasher()
+	if h == nil {
+		return configError("Hasher", "hasher returns nil")
+	}
+	if h.Size() <= 0 {
+		return configError("Hasher", "hasher returns a hash of size %d", h.Size())
+	}
+
+	if err := validateEncoding(q.encoder(), h.Size()); err != nil {
+		return &ConfigError{Option: "Encoder", Err: err}
+	}
+	if q.verifier != nil {
+		if _, ok := q.encoder().(Decoding); !ok {
+			return configError("Encoder", "encoding can't decode signatures for the verifier")
+		}
+	}
+
+	if q.keyRing != nil || q.keyResolver != nil {
+		if q.keyRing != nil && q.keyResolver != nil {
+			return configError("KeyResolver", "KeyRing and KeyResolver conflict")
+		}
+		if q.keySuffix == nil && q.keyedHasher == nil {
+			return configError("KeySuffix", "keys need KeySuffix or KeyedHasher to be applied")
+		}
+	}
+	if len(q.keyIDKey) > 0 && q.keyRing == nil {
+		return configError("KeyIDKey", "KeyIDKey needs a KeyRing")
+	}
+	if q.keyedHasher != nil {
+		if h := q.keyedHasher(nil); h == nil || h.Size() <= 0 {
+			return configError("KeyedHasher", "keyed hasher returns an invalid hash")
+		}
+	}
+
+	if q.tolerance < 0 {
+		return configError("Tolerance", "negative tolerance %s", q.tolerance)
+	}
+	if len(q.nonceKey) > 0 {
+		if err := validateNonceAlphabet(q.nonceAlphabet); err != nil {
+			return err
+		}
+		if q.nonceLength < 0 {
+			return configError("NonceLength", "invalid nonce length %d", q.nonceLength)
+		}
+	}
+
+	return nil
+}
+
+// escapedQueryReserved are bytes of escapes in EscapedQueryDigest mode, which can't be escaped
+// as delimiters or connectors.
+const escapedQueryReserved = "%0123456789ABCDEF"
+
+// validateOptions checks if options override each other. NewQsign resolves them by
+// precedence, so they're checked before being defaulted.
+func validateOptions(options Options) error {
+	if options.KeySuffix != nil {
+		generators := []struct {
+			name  string
+			given bool
+		}{
+			{"SuffixGenerator", options.SuffixGenerator != nil},
+			{"ContextSuffixGenerator", options.ContextSuffixGenerator != nil},
+			{"PairsSuffixGenerator", options.PairsSuffixGenerator != nil},
+		}
+		for _, g := range generators {
+			if g.given {
+				return configError("KeySuffix", "KeySuffix and %s conflict", g.name)
+			}
+		}
+	}
+	if options.Hasher != nil && options.KeyedHasher != nil {
+		return configError("KeyedHasher", "Hasher and KeyedHasher conflict")
+	}
+	if options.KeyResolver != nil && options.ContextKeyResolver != nil {
+		return configError("ContextKeyResolver", "KeyResolver and ContextKeyResolver conflict")
+	}
+
+	if options.DigestMode == CanonicalJSONDigest || options.DigestMode == LengthPrefixedDigest {
+		if len(options.Delimiter) > 0 {
+			return configError("Delimiter", "Delimiter and DigestMode conflict, canonical JSON and length-prefixed digests don't use it")
+		}
+		if len(options.Connector) > 0 {
+			return configError("Connector", "Connector and DigestMode conflict, canonical JSON and length-prefixed digests don't use it")
+		}
+	}
+
+	return nil
+}
+
+// validateSeparators checks if pairs connected by connector and delimiter can be told apart.
+// If they're ambiguous, the connector is reported when the delimiter is the default one.
+func validateSeparators(delimiter, connector string) error {
+	if len(delimiter) == 0 {
+		return configError("Delimiter", "empty delimiter")
+	}
+	if len(connector) == 0 {
+		return configError("Connector", "empty connector")
+	}
+	if strings.Contains(delimiter, connector) || strings.Contains(connector, delimiter) {
+		option := "Delimiter"
+		if delimiter == "&" {
+			option = "Connector"
+		}
+		return configError(option, "ambiguous delimiter %q and connector %q", delimiter, connector)
+	}
+	return nil
+}
+
+// validateEncoding checks if e writes exactly EncodedLen bytes, encoding inputs of up to size
+// bytes. Each input is encoded twice into buffers filled differently, so bytes left unwritten
+// and bytes written beyond EncodedLen are told by comparing them.
+func validateEncoding(e Encoding, size int) (err error) {
+	if e == nil {
+		return errors.New("encoder returns nil")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("encoding panics: %v", r)
+		}
+	}()
+
+	for _, n := range []int{1, 2, 3, size} {
+		src := make([]byte, n)
+		for i := range src {
+			src[i] = byte(i)
+		}
+
+		m := e.EncodedLen(n)
+		if m < 0 {
+			return fmt.Errorf("encoding returns negative length %d", m)
+		}
+
+		const slack = 16
+		a, b := make([]byte, m+slack), make([]byte, m+slack)
+		for i := range b {
+			b[i] = 0xff
+		}
+		e.Encode(a, src)
+		e.Encode(b, src)
+
+		for i := 0; i < m; i++ {
+			if a[i] != b[i] {
+				return fmt.Errorf("encoding writes less than EncodedLen(%d) = %d bytes", n, m)
+			}
+		}
+		for i := m; i < len(a); i++ {
+			if a[i] != 0 || b[i] != 0xff {
+				return fmt.Errorf("encoding writes more than EncodedLen(%d) = %d bytes", n, m)
+			}
+		}
+	}
+	return nil
+}
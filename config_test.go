@@ -0,0 +1,144 @@
+package qsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"testing"
+)
+
+// shortEncoding claims twice the length hex encoding writes.
+type shortEncoding struct{ hexEncoding }
+
+func (e *shortEncoding) EncodedLen(n int) int { return hex.EncodedLen(n) * 2 }
+
+// longEncoding claims the length of the input, while hex encoding writes twice of it.
+type longEncoding struct{ hexEncoding }
+
+func (e *longEncoding) EncodedLen(n int) int { return n }
+
+type emptyHash struct{ hash.Hash }
+
+func (h emptyHash) Size() int { return 0 }
+
+func TestNew(t *testing.T) {
+	hmacSHA256 := func(secret []byte) hash.Hash { return hmac.New(sha256.New, secret) }
+
+	cases := []struct {
+		options Options
+		valid   bool
+	}{
+		{Options{}, true},
+		{Options{Delimiter: ",", Connector: ":"}, true},
+		{Options{Delimiter: "&", Connector: "&"}, false},
+		{Options{Delimiter: "&&", Connector: "&"}, false},
+		{Options{Delimiter: "=", Connector: "=="}, false},
+		{Options{DigestMode: CanonicalJSONDigest}, true},
+		{Options{Delimiter: "&", DigestMode: CanonicalJSONDigest}, false},
+		{Options{Connector: ":", DigestMode: CanonicalJSONDigest}, false},
+		{Options{DigestMode: EscapedQueryDigest}, true},
+		{Options{Delimiter: "%", DigestMode: EscapedQueryDigest}, false},
+		{Options{Delimiter: "A", DigestMode: EscapedQueryDigest}, false},
+		{Options{DigestMode: LengthPrefixedDigest}, true},
+		{Options{Delimiter: "&", Connector: "&", DigestMode: LengthPrefixedDigest}, false},
+		{Options{DigestMode: DigestMode(7)}, false},
+		{Options{Encoder: func() Encoding { return base64.RawURLEncoding }}, true},
+		{Options{Encoder: upperHexEncoder}, true},
+		{Options{Encoder: func() Encoding { return nil }}, false},
+		{Options{Encoder: func() Encoding { return &shortEncoding{} }}, false},
+		{Options{Encoder: func() Encoding { return &longEncoding{} }}, false},
+		{Options{Hasher: func() hash.Hash { return nil }}, false},
+		{Options{Hasher: func() hash.Hash { return emptyHash{sha256.New()} }}, false},
+		{Options{Verifier: NewRSAVerifier(nil, 0)}, true},
+		{Options{Verifier: NewRSAVerifier(nil, 0), Encoder: func() Encoding { return &encodeOnly{} }}, false},
+		{Options{KeyRing: NewKeyRing(), KeyedHasher: hmacSHA256}, true},
+		{Options{KeyRing: NewKeyRing()}, false},
+		{Options{KeyRing: NewKeyRing(), KeyedHasher: hmacSHA256, KeyResolver: KeyByField("app", nil)}, false},
+		{Options{KeyResolver: KeyByField("app", nil), KeySuffix: func(s string) string { return s }}, true},
+		{Options{KeyIDKey: "kid", KeyedHasher: hmacSHA256}, false},
+		{Options{KeyRing: NewKeyRing(), KeyedHasher: func([]byte) hash.Hash { return nil }}, false},
+		{Options{Tolerance: -1}, false},
+		{Options{NonceKey: "nonce", NonceLength: -1}, false},
+		{Options{NonceKey: "nonce", NonceAlphabet: string(make([]byte, 257))}, false},
+		{Options{NonceKey: "nonce", NonceAlphabet: "0123456789abcdef0"}, false},
+		{Options{NonceKey: "nonce", NonceAlphabet: "ab\xff"}, false},
+		{Options{NonceKey: "nonce", NonceAlphabet: "αβγ"}, true},
+	}
+
+	for i, c := range cases {
+		q, err := New(c.options)
+		if c.valid && (err != nil || q == nil) {
+			t.Errorf("case %d: expect options are valid, got error %v", i, err)
+		}
+		if !c.valid && (err == nil || q != nil) {
+			t.Errorf("case %d: expect options are invalid", i)
+		}
+	}
+}
+
+func TestQsignValidate(t *testing.T) {
+	q, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		q      *Qsign
+		option string
+	}{
+		{q.WithDelimiter(""), "Delimiter"},
+		{q.WithDelimiter("="), "Delimiter"},
+		{q.WithConnector("&"), "Connector"},
+		{q.WithConnector(""), "Connector"},
+		{q.WithDigestMode(EscapedQueryDigest).WithDelimiter("%"), "Delimiter"},
+		{q.WithDigestMode(EscapedQueryDigest).WithConnector("A"), "Connector"},
+	}
+
+	for i, c := range cases {
+		var ce *ConfigError
+		if err := c.q.Validate(); !errors.As(err, &ce) || ce.Option != c.option {
+			t.Errorf("case %d: expect option %s is invalid, actual %v", i, c.option, err)
+		}
+	}
+
+	if err := q.WithDelimiter(",").WithConnector(":").Validate(); err != nil {
+		t.Errorf("expect derived copy is valid, got %v", err)
+	}
+
+	if err := new(Qsign).Validate(); err == nil {
+		t.Error("expect zero Qsign without hasher, encoder and filter is invalid")
+	}
+}
+
+func TestQsignWithNil(t *testing.T) {
+	v := struct {
+		A string
+		B string
+	}{"1", ""}
+	q := NewQsign(Options{})
+	expect, err := q.Sign(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []*Qsign{
+		q.WithHasher(nil),
+		q.WithEncoder(nil),
+		q.WithFilter(nil),
+		q.WithHasher(sha256.New).WithHasher(nil),
+	}
+
+	for i, c := range cases {
+		if err := c.Validate(); err != nil {
+			t.Errorf("case %d: expect nil falls back to the default, got %v", i, err)
+			continue
+		}
+		s, err := c.Sign(v)
+		if err != nil || string(s) != string(expect) {
+			t.Errorf("case %d: expect signature %s, actual %s, %v", i, expect, s, err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package qsign
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"math/big"
+)
+
+type ecdsaSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+// NewECDSASigner returns a Signer signing checksums with ECDSA. Signatures are r and s
+// concatenated as fixed-size big-endian integers, like JWS and RFC 9421 do.
+func NewECDSASigner(key *ecdsa.PrivateKey) Signer {
+	return &ecdsaSigner{key: key}
+}
+
+func (s *ecdsaSigner) Sign(sum []byte) ([]byte, error) {
+	r, ss, err := ecdsa.Sign(rand.Reader, s.key, sum)
+	if err != nil {
+		return nil, err
+	}
+
+	size := ecdsaSize(&s.key.PublicKey)
+	sig := make([]byte, 2*size)
+	rb, sb := r.Bytes(), ss.Bytes()
+	copy(sig[size-len(rb):size], rb)
+	copy(sig[2*size-len(sb):], sb)
+	return sig, nil
+}
+
+type ecdsaVerifier struct {
+	key *ecdsa.PublicKey
+}
+
+// NewECDSAVerifier returns a Verifier verifying ECDSA signatures made by NewECDSASigner.
+func NewECDSAVerifier(key *ecdsa.PublicKey) Verifier {
+	return &ecdsaVerifier{key: key}
+}
+
+func (v *ecdsaVerifier) Verify(sum, signature []byte) error {
+	size := ecdsaSize(v.key)
+	if len(signature) != 2*size {
+		return ErrSignatureMismatch
+	}
+
+	r := new(big.Int).SetBytes(signature[:size])
+	s := new(big.Int).SetBytes(signature[size:])
+	if !ecdsa.Verify(v.key, sum, r, s) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// ecdsaSize returns the size in bytes of r and s of signatures made with key.
+func ecdsaSize(key *ecdsa.PublicKey) int {
+	return (key.Curve.Params().BitSize + 7) / 8
+}
@@ -0,0 +1,46 @@
+package qsign
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+func TestECDSASignerVerifier(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("expect no error generating ECDSA key, actual %v", err)
+	}
+	sum := sha256.Sum256([]byte("appid=wxd930ea5d5a258f4f&body=test"))
+
+	signature, err := NewECDSASigner(key).Sign(sum[:])
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	if len(signature) != 64 {
+		t.Fatalf("expect signature has 64 bytes, actual %d", len(signature))
+	}
+
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(&key.PublicKey, sum[:], r, s) {
+		t.Errorf("expect signature is r || s")
+	}
+
+	verifier := NewECDSAVerifier(&key.PublicKey)
+	if err := verifier.Verify(sum[:], signature); err != nil {
+		t.Errorf("expect signature is valid, actual %v", err)
+	}
+
+	if err := verifier.Verify(sum[:], signature[1:]); err != ErrSignatureMismatch {
+		t.Errorf("expect signature mismatch for short signature, actual %v", err)
+	}
+
+	signature[0] ^= 0xff
+	if err := verifier.Verify(sum[:], signature); err != ErrSignatureMismatch {
+		t.Errorf("expect signature mismatch, actual %v", err)
+	}
+}
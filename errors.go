@@ -0,0 +1,117 @@
+package qsign
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	// ErrSignatureMismatch is returned when a signature doesn't match the data.
+	ErrSignatureMismatch = errors.New("qsign: signature mismatch")
+
+	// ErrExpired is returned when the timestamp of a message, or the creation or expiration
+	// time of a signature, is out of tolerance.
+	ErrExpired = errors.New("qsign: signature expired")
+
+	// ErrReplay is returned when the nonce of a message has been used.
+	ErrReplay = errors.New("qsign: nonce has been used")
+
+	// ErrInactiveKey is returned when the key or the certificate to sign or verify with isn't
+	// valid at the time.
+	ErrInactiveKey = errors.New("qsign: key is not active")
+
+	// ErrNonceStoreFull is returned by the in-memory NonceStore when it holds as many unexpired
+	// nonces as its capacity, so a message can't be checked against replays.
+	ErrNonceStoreFull = errors.New("qsign: nonce store is full")
+
+	// errMissingField is the reason of a *FieldError of a required key missing in the data.
+	errMissingField = errors.New("missing field")
+)
+
+// FieldError is returned when a field of the data being signed can't be signed, like a struct
+// embedding itself or a value which can't be serialized.
+type FieldError struct {
+	// Path is the Go path of the field, like "Order.Item". Once fields are resolved to
+	// key-value pairs, like in canonical JSON digests, it's the key.
+	Path string
+
+	// Type is the type of the field, if it's known.
+	Type reflect.Type
+
+	// Err is the reason.
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	s := "qsign:"
+	if len(e.Path) > 0 {
+		s += " field " + e.Path
+		if e.Type != nil {
+			s += " of"
+		}
+	}
+	if e.Type != nil {
+		s += " type " + e.Type.String()
+	}
+	return s + ": " + e.Err.Error()
+}
+
+// Unwrap returns the reason of e.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Collision is a key produced by more than one field, with the Go paths of the fields.
+type Collision struct {
+	Key   string
+	Paths []string
+}
+
+// CollisionError is returned with StrictKeys when more than one field produces the same key.
+// It unwraps to a *FieldError of the first colliding field.
+type CollisionError struct {
+	// Collisions are sorted by key.
+	Collisions []Collision
+}
+
+func (e *CollisionError) Error() string {
+	list := make([]string, len(e.Collisions))
+	for i, c := range e.Collisions {
+		list[i] = fmt.Sprintf("%s (%s)", c.Key, strings.Join(c.Paths, ", "))
+	}
+	return "qsign: duplicate keys: " + strings.Join(list, "; ")
+}
+
+// Unwrap returns a *FieldError of the first colliding field.
+func (e *CollisionError) Unwrap() error {
+	if len(e.Collisions) == 0 {
+		return nil
+	}
+	c := e.Collisions[0]
+	return &FieldError{Path: c.Paths[0], Err: fmt.Errorf("duplicate key %q", c.Key)}
+}
+
+// ConfigError is returned when options of a Qsign are invalid or conflict.
+type ConfigError struct {
+	// Option is the name of the invalid option in Options, like "Delimiter".
+	Option string
+
+	// Err is the reason.
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("qsign: invalid %s: %v", e.Option, e.Err)
+}
+
+// Unwrap returns the reason of e.
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// configError returns a *ConfigError of option, with the reason formatted by format.
+func configError(option, format string, a ...interface{}) error {
+	return &ConfigError{Option: option, Err: fmt.Errorf(format, a...)}
+}
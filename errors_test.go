@@ -0,0 +1,212 @@
+package qsign
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestErrorsIs(t *testing.T) {
+	now := time.Unix(1554208460, 0)
+	q := NewQsign(Options{
+		TimestampKey: "timestamp",
+		NonceKey:     "nonce",
+		Clock:        func() time.Time { return now },
+	})
+
+	type message struct {
+		Timestamp int64  `qsign:"timestamp"`
+		Nonce     string `qsign:"nonce"`
+	}
+	fresh := message{Timestamp: now.Unix(), Nonce: "a"}
+	expired := message{Timestamp: now.Add(-time.Hour).Unix(), Nonce: "b"}
+
+	sign := func(v interface{}) []byte {
+		s, err := q.Sign(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	req, _ := http.NewRequest("GET", "https://example.com/", nil)
+	signer, _ := NewHTTPSigner("sig", "key", HTTPSigHMACSHA256, []byte("secret"), []string{"@method"})
+	signer.now = func() time.Time { return now.Add(-time.Hour) }
+	if err := signer.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	verifier := NewHTTPVerifier(func(string) (string, interface{}, error) {
+		return HTTPSigHMACSHA256, []byte("secret"), nil
+	}, time.Minute, nil)
+	verifier.now = func() time.Time { return now }
+	_, httpErr := verifier.Verify(req, "sig")
+
+	cases := []struct {
+		err    error
+		expect error
+	}{
+		{q.Verify(fresh, []byte("bad")), ErrSignatureMismatch},
+		{q.Verify(fresh, sign(fresh)), nil},
+		{q.Verify(fresh, sign(fresh)), ErrReplay},
+		{q.Verify(expired, sign(expired)), ErrExpired},
+		{NewGitHubWebhook("secret").Verify(http.Header{"X-Hub-Signature-256": {"sha256=00"}}, nil), ErrSignatureMismatch},
+		{httpErr, ErrExpired},
+	}
+
+	for i, c := range cases {
+		if !errors.Is(c.err, c.expect) {
+			t.Errorf("case %d: expect error %v, actual is %v", i, c.expect, c.err)
+		}
+	}
+}
+
+func TestFieldError(t *testing.T) {
+	q := NewQsign(Options{})
+	jq := NewQsign(Options{DigestMode: CanonicalJSONDigest})
+	cycle := &recursiveDynamic{ID: 1}
+	cycle.anyForTest = cycle
+	digest := func(q *Qsign, v interface{}) error {
+		_, err := q.Digest(v)
+		return err
+	}
+	sign := func(q *Qsign, v interface{}) error {
+		_, err := q.Sign(v)
+		return err
+	}
+	_, alipayErr := NewAlipay("MD5", nil)
+	stripeErr := NewStripeWebhook(DefaultWebhookTolerance, "secret").Verify(http.Header{
+		"Stripe-Signature": {"t=now,v1=00"},
+	}, nil)
+	slackErr := NewSlackWebhook(DefaultWebhookTolerance, "secret").Verify(http.Header{
+		"X-Slack-Request-Timestamp": {"now"},
+		"X-Slack-Signature":         {"v0=00"},
+	}, nil)
+
+	cases := []struct {
+		err    error
+		path   string
+		typ    reflect.Type
+		reason string
+	}{
+		{
+			err:    digest(q, recursiveNode{ID: 1}),
+			path:   "recursiveNode",
+			typ:    reflect.TypeOf(recursiveNode{}),
+			reason: "qsign: field recursiveNode of type qsign.recursiveNode: recursive embedding",
+		},
+		{
+			err:    sign(q, cycle),
+			path:   "anyForTest",
+			typ:    reflect.TypeOf(recursiveDynamic{}),
+			reason: "qsign: field anyForTest of type qsign.recursiveDynamic: recursive embedding",
+		},
+		{
+			err:    sign(q, []string{"a"}),
+			typ:    reflect.TypeOf([]string{}),
+			reason: "qsign: type []string: unsupported type, want a struct or a map with string keys",
+		},
+		{
+			err:    digest(jq, map[string]float64{"amount": math.Inf(1)}),
+			path:   "amount",
+			reason: "qsign: field amount: NaN and Infinity are not allowed in canonical JSON",
+		},
+		{
+			err:    sign(jq, struct{ Name string }{"\xff"}),
+			path:   "Name",
+			reason: "qsign: field Name: invalid UTF-8 string in canonical JSON",
+		},
+		{
+			err:    sign(NewWechatPayV2("key"), map[string]string{"sign_type": "SHA1"}),
+			path:   "sign_type",
+			reason: `qsign: field sign_type: unsupported WeChat Pay sign type "SHA1"`,
+		},
+		{
+			err:    alipayErr,
+			path:   "sign_type",
+			reason: `qsign: field sign_type: unsupported Alipay sign type "MD5"`,
+		},
+		{
+			err:    sign(NewTencentCloudV1("key", "GET", "cvm.tencentcloudapi.com", "/"), map[string]string{"SignatureMethod": "HmacMD5"}),
+			path:   "SignatureMethod",
+			reason: `qsign: field SignatureMethod: unsupported Tencent Cloud signature method "HmacMD5"`,
+		},
+		{
+			err:    stripeErr,
+			path:   "Stripe-Signature",
+			reason: `qsign: field Stripe-Signature: invalid timestamp "now"`,
+		},
+		{
+			err:    slackErr,
+			path:   "X-Slack-Request-Timestamp",
+			reason: `qsign: field X-Slack-Request-Timestamp: invalid timestamp "now"`,
+		},
+	}
+
+	for i, c := range cases {
+		var fe *FieldError
+		if !errors.As(c.err, &fe) {
+			t.Errorf("case %d: expect a *FieldError, actual is %v", i, c.err)
+			continue
+		}
+		if fe.Path != c.path || fe.Type != c.typ {
+			t.Errorf("case %d: expect field %s of type %v, actual is %s of type %v", i, c.path, c.typ, fe.Path, fe.Type)
+		}
+		if fe.Error() != c.reason {
+			t.Errorf("case %d: expect error %q, actual is %q", i, c.reason, fe.Error())
+		}
+	}
+}
+
+func TestConfigError(t *testing.T) {
+	build := func(options Options) error {
+		_, err := New(options)
+		return err
+	}
+	_, _, injectErr := NewQsign(Options{}).SignInject(struct{}{})
+	verifyErr := NewQsign(Options{
+		Verifier: NewRSAVerifier(nil, 0),
+		Encoder:  func() Encoding { return &encodeOnly{} },
+	}).Verify(struct{}{}, nil)
+
+	cases := []struct {
+		err    error
+		option string
+	}{
+		{build(Options{Delimiter: "&", Connector: "&"}), "Connector"},
+		{build(Options{Delimiter: "=", Connector: ""}), "Delimiter"},
+		{build(Options{Connector: "2", DigestMode: EscapedQueryDigest}), "Connector"},
+		{build(Options{Delimiter: ",", DigestMode: CanonicalJSONDigest}), "Delimiter"},
+		{build(Options{Connector: ":", DigestMode: LengthPrefixedDigest}), "Connector"},
+		{build(Options{KeySuffix: func(string) string { return "" }, SuffixGenerator: func() string { return "" }}), "KeySuffix"},
+		{build(Options{KeySuffix: func(string) string { return "" }, PairsSuffixGenerator: func(context.Context, []Pair) (string, error) { return "", nil }}), "KeySuffix"},
+		{build(Options{Hasher: sha256.New, KeyedHasher: func(key []byte) hash.Hash { return hmac.New(sha256.New, key) }}), "KeyedHasher"},
+		{build(Options{KeyResolver: KeyByField("app", nil), ContextKeyResolver: func(context.Context, []Pair) (string, error) { return "", nil }}), "ContextKeyResolver"},
+		{build(Options{KeyRing: NewKeyRing()}), "KeySuffix"},
+		{build(Options{Tolerance: -1}), "Tolerance"},
+		{injectErr, "TimestampKey"},
+		{verifyErr, "Encoder"},
+	}
+
+	for i, c := range cases {
+		var ce *ConfigError
+		if !errors.As(c.err, &ce) {
+			t.Errorf("case %d: expect a *ConfigError, actual is %v", i, c.err)
+			continue
+		}
+		if ce.Option != c.option {
+			t.Errorf("case %d: expect option %s is invalid, actual is %s", i, c.option, ce.Option)
+		}
+	}
+
+	err := &ConfigError{Option: "Delimiter", Err: errors.New("empty delimiter")}
+	if expect := "qsign: invalid Delimiter: empty delimiter"; err.Error() != expect {
+		t.Errorf("expect error %q, actual is %q", expect, err.Error())
+	}
+}
@@ -0,0 +1,515 @@
+package qsign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Algorithms of HTTP Message Signatures (RFC 9421).
+const (
+	HTTPSigHMACSHA256      = "hmac-sha256"
+	HTTPSigRSAV15SHA256    = "rsa-v1_5-sha256"
+	HTTPSigRSAPSSSHA512    = "rsa-pss-sha512"
+	HTTPSigECDSAP256SHA256 = "ecdsa-p256-sha256"
+)
+
+// DefaultHTTPSigClockSkew is how far the "created" parameter of signatures may be ahead of the
+// clock of HTTPVerifier by default, allowing for clocks of signers running fast.
+const DefaultHTTPSigClockSkew = time.Minute
+
+const (
+	httpSigSignatureParams  = "@signature-params"
+	httpSigContentDigest    = "content-digest"
+	httpSigContentDigestAlg = "sha-256"
+)
+
+// contentDigestQsigns hash bodies for the "Content-Digest" header (RFC 9530) by algorithm.
+var contentDigestQsigns = map[string]*Qsign{
+	"sha-256": NewQsign(Options{Hasher: sha256.New, Encoder: base64Encoder}),
+	"sha-512": NewQsign(Options{Hasher: sha512.New, Encoder: base64Encoder}),
+}
+
+// HTTPSigner signs requests by HTTP Message Signatures (RFC 9421).
+type HTTPSigner struct {
+	label      string
+	keyID      string
+	components []string
+	q          *Qsign
+
+	// now generates the "created" parameter, replaced in tests.
+	now func() time.Time
+}
+
+// NewHTTPSigner returns a *HTTPSigner signing requests with key, identified by keyID, using
+// algorithm alg. Signatures are labeled label and cover components in order.
+//
+// Key is a []byte secret for HTTPSigHMACSHA256, a *rsa.PrivateKey for HTTPSigRSAV15SHA256 and
+// HTTPSigRSAPSSSHA512, or a *ecdsa.PrivateKey on curve P-256 for HTTPSigECDSAP256SHA256.
+// Ed25519 is not supported.
+//
+// Components are derived components "@method", "@authority", "@scheme", "@target-uri",
+// "@request-target", "@path" and "@query", or header names. If "content-digest" is covered
+// and the request has no such header, it's set to the SHA-256 digest of the body.
+func NewHTTPSigner(label, keyID, alg string, key interface{}, components []string) (*HTTPSigner, error) {
+	if !isSFKey(label) {
+		return nil, fmt.Errorf("qsign: invalid signature label %q", label)
+	}
+
+	names := make([]string, len(components))
+	for i, c := range components {
+		names[i] = strings.ToLower(c)
+	}
+
+	q, err := newHTTPSigQsign(alg, key)
+	if err != nil {
+		return nil, err
+	}
+	if q.verifier != nil && q.signer == nil {
+		return nil, errors.New("qsign: can't sign with a public key")
+	}
+
+	return &HTTPSigner{
+		label:      label,
+		keyID:      keyID,
+		components: names,
+		q:          q,
+		now:        time.Now,
+	}, nil
+}
+
+// Sign adds the "Signature-Input" and "Signature" headers to req. Signatures of other labels
+// are kept. The body is read and restored for sending if its digest is computed.
+func (s *HTTPSigner) Sign(req *http.Request) error {
+	list := make([]*sfItem, len(s.components))
+	for i, c := range s.components {
+		if c == httpSigContentDigest && len(req.Header.Get("Content-Digest")) == 0 {
+			digest, err := contentDigest(req, httpSigContentDigestAlg)
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Content-Digest", httpSigContentDigestAlg+"=:"+digest+":")
+		}
+		list[i] = &sfItem{value: c}
+	}
+
+	input := &sfItem{
+		value: list,
+		params: []sfParam{
+			{key: "created", value: s.now().Unix()},
+			{key: "keyid", value: s.keyID},
+		},
+	}
+
+	base, err := httpSigBase(req, input)
+	if err != nil {
+		return err
+	}
+
+	sig, err := s.q.SignBytes(base)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("Signature-Input", s.label+"="+input.serialize())
+	req.Header.Add("Signature", s.label+"=:"+string(sig)+":")
+	return nil
+}
+
+// HTTPSigKeyResolver returns the algorithm and the key identified by keyID, used to verify
+// signatures. Keys are like those of NewHTTPSigner, public keys are accepted as well.
+type HTTPSigKeyResolver func(keyID string) (alg string, key interface{}, err error)
+
+// HTTPVerifier verifies requests signed by HTTP Message Signatures (RFC 9421).
+type HTTPVerifier struct {
+	resolve  HTTPSigKeyResolver
+	maxAge   time.Duration
+	skew     time.Duration
+	required []string
+
+	// now is the time signatures are checked at, replaced in tests.
+	now func() time.Time
+}
+
+// NewHTTPVerifier returns a *HTTPVerifier verifying signatures with keys from resolve.
+// Signatures must cover all the required components, and must be created within maxAge if it's
+// not zero. Signatures with an "expires" parameter are rejected after that time, and those
+// created more than DefaultHTTPSigClockSkew ahead of now are rejected as well.
+func NewHTTPVerifier(resolve HTTPSigKeyResolver, maxAge time.Duration, required []string) *HTTPVerifier {
+	names := make([]string, len(required))
+	for i, c := range required {
+		names[i] = strings.ToLower(c)
+	}
+
+	return &HTTPVerifier{
+		resolve:  resolve,
+		maxAge:   maxAge,
+		skew:     DefaultHTTPSigClockSkew,
+		required: names,
+		now:      time.Now,
+	}
+}
+
+// WithClockSkew returns a copy of v accepting signatures created up to skew ahead of now.
+func (v *HTTPVerifier) WithClockSkew(skew time.Duration) *HTTPVerifier {
+	c := *v
+	c.skew = skew
+	return &c
+}
+
+// Verify verifies the signature labeled label of req, and returns the key ID of it. If
+// "content-digest" is covered, the body is checked against it, and restored for reading.
+func (v *HTTPVerifier) Verify(req *http.Request, label string) (string, error) {
+	inputs, err := parseSFDictionary(strings.Join(req.Header["Signature-Input"], ", "))
+	if err != nil {
+		return "", err
+	}
+	sigs, err := parseSFDictionary(strings.Join(req.Header["Signature"], ", "))
+	if err != nil {
+		return "", err
+	}
+
+	input, ok := inputs[label]
+	if !ok {
+		return "", fmt.Errorf("%w: no signature input labeled %q", ErrSignatureMismatch, label)
+	}
+	list, ok := input.value.([]*sfItem)
+	if !ok {
+		return "", fmt.Errorf("%w: signature input %q is not an inner list", ErrSignatureMismatch, label)
+	}
+	sig, ok := sigs[label]
+	if !ok {
+		return "", fmt.Errorf("%w: no signature labeled %q", ErrSignatureMismatch, label)
+	}
+	raw, ok := sig.value.([]byte)
+	if !ok {
+		return "", fmt.Errorf("%w: signature %q is not a byte sequence", ErrSignatureMismatch, label)
+	}
+
+	keyID, _ := paramString(input, "keyid")
+	if len(keyID) == 0 {
+		return "", fmt.Errorf("%w: signature has no key ID", ErrSignatureMismatch)
+	}
+
+	if err := v.checkTime(input); err != nil {
+		return keyID, err
+	}
+
+	covered := map[string]bool{}
+	for _, c := range list {
+		if name, ok := c.value.(string); ok {
+			covered[name] = true
+		}
+	}
+	for _, c := range v.required {
+		if !covered[c] {
+			return keyID, fmt.Errorf("%w: component %q is not signed", ErrSignatureMismatch, c)
+		}
+	}
+
+	alg, key, err := v.resolve(keyID)
+	if err != nil {
+		return keyID, err
+	}
+	if a, ok := paramString(input, "alg"); ok && a != alg {
+		return keyID, fmt.Errorf("%w: algorithm %q doesn't match key %q", ErrSignatureMismatch, a, keyID)
+	}
+
+	q, err := newHTTPSigQsign(alg, key)
+	if err != nil {
+		return keyID, err
+	}
+
+	base, err := httpSigBase(req, input)
+	if err != nil {
+		return keyID, err
+	}
+
+	if err := q.VerifyBytes(base, []byte(base64.StdEncoding.EncodeToString(raw))); err != nil {
+		return keyID, err
+	}
+
+	if covered[httpSigContentDigest] {
+		return keyID, verifyContentDigest(req)
+	}
+	return keyID, nil
+}
+
+// checkTime checks the "created" and "expires" parameters of input.
+func (v *HTTPVerifier) checkTime(input *sfItem) error {
+	now := v.now()
+
+	if p, ok := input.param("expires"); ok {
+		expires, ok := p.(int64)
+		if !ok {
+			return fmt.Errorf("%w: invalid expires parameter", ErrSignatureMismatch)
+		}
+		if now.Unix() > expires {
+			return ErrExpired
+		}
+	}
+
+	p, ok := input.param("created")
+	created, isInt := p.(int64)
+	if ok && !isInt {
+		return fmt.Errorf("%w: invalid created parameter", ErrSignatureMismatch)
+	}
+	if ok && time.Unix(created, 0).After(now.Add(v.skew)) {
+		return ErrExpired
+	}
+
+	if v.maxAge == 0 {
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("%w: signature has no created time", ErrSignatureMismatch)
+	}
+	if now.Sub(time.Unix(created, 0)) > v.maxAge {
+		return ErrExpired
+	}
+	return nil
+}
+
+// httpSigBase returns the signature base of req, covering components of input.
+func httpSigBase(req *http.Request, input *sfItem) ([]byte, error) {
+	var buf bytes.Buffer
+	seen := map[string]bool{}
+
+	for _, c := range input.value.([]*sfItem) {
+		name, ok := c.value.(string)
+		if !ok || len(c.params) > 0 {
+			return nil, fmt.Errorf("qsign: unsupported component %s", c.serialize())
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("qsign: duplicate component %q", name)
+		}
+		seen[name] = true
+
+		value, err := httpSigComponent(req, name)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.WriteString(`"` + name + `": `)
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+
+	buf.WriteString(`"` + httpSigSignatureParams + `": `)
+	buf.WriteString(input.serialize())
+
+	return buf.Bytes(), nil
+}
+
+// httpSigComponent returns the value of component name of req.
+func httpSigComponent(req *http.Request, name string) (string, error) {
+	switch name {
+	case "@method":
+		return req.Method, nil
+	case "@authority", "host":
+		return strings.ToLower(httpSigHost(req)), nil
+	case "@scheme":
+		return httpSigScheme(req), nil
+	case "@target-uri":
+		return httpSigScheme(req) + "://" + strings.ToLower(httpSigHost(req)) + req.URL.RequestURI(), nil
+	case "@request-target":
+		return req.URL.RequestURI(), nil
+	case "@path":
+		if p := req.URL.EscapedPath(); len(p) > 0 {
+			return p, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + req.URL.RawQuery, nil
+	}
+
+	if strings.HasPrefix(name, "@") {
+		return "", fmt.Errorf("qsign: unsupported component %q", name)
+	}
+
+	values, ok := req.Header[textproto.CanonicalMIMEHeaderKey(name)]
+	if !ok {
+		return "", fmt.Errorf("qsign: missing header %q", name)
+	}
+
+	trimmed := make([]string, len(values))
+	for i, value := range values {
+		trimmed[i] = strings.TrimSpace(value)
+	}
+	return strings.Join(trimmed, ", "), nil
+}
+
+// httpSigHost returns the host of req, which is req.Host for server requests.
+func httpSigHost(req *http.Request) string {
+	if len(req.Host) > 0 {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+// httpSigScheme returns the scheme of req, which is inferred from TLS for server requests.
+func httpSigScheme(req *http.Request) string {
+	if len(req.URL.Scheme) > 0 {
+		return strings.ToLower(req.URL.Scheme)
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// newHTTPSigQsign returns a *Qsign signing signature bases by alg with key.
+func newHTTPSigQsign(alg string, key interface{}) (*Qsign, error) {
+	options := Options{Encoder: base64Encoder}
+	badKey := fmt.Errorf("qsign: invalid key %T for algorithm %q", key, alg)
+
+	switch alg {
+	case HTTPSigHMACSHA256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return nil, badKey
+		}
+		options.Hasher = func() hash.Hash {
+			return hmac.New(sha256.New, secret)
+		}
+	case HTTPSigRSAV15SHA256:
+		options.Hasher = sha256.New
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			options.Signer = NewRSASigner(k, crypto.SHA256)
+			options.Verifier = NewRSAVerifier(&k.PublicKey, crypto.SHA256)
+		case *rsa.PublicKey:
+			options.Verifier = NewRSAVerifier(k, crypto.SHA256)
+		default:
+			return nil, badKey
+		}
+	case HTTPSigRSAPSSSHA512:
+		options.Hasher = sha512.New
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			options.Signer = NewRSAPSSSigner(k, crypto.SHA512)
+			options.Verifier = NewRSAPSSVerifier(&k.PublicKey, crypto.SHA512)
+		case *rsa.PublicKey:
+			options.Verifier = NewRSAPSSVerifier(k, crypto.SHA512)
+		default:
+			return nil, badKey
+		}
+	case HTTPSigECDSAP256SHA256:
+		options.Hasher = sha256.New
+		switch k := key.(type) {
+		case *ecdsa.PrivateKey:
+			if k.Curve != elliptic.P256() {
+				return nil, badKey
+			}
+			options.Signer = NewECDSASigner(k)
+			options.Verifier = NewECDSAVerifier(&k.PublicKey)
+		case *ecdsa.PublicKey:
+			if k.Curve != elliptic.P256() {
+				return nil, badKey
+			}
+			options.Verifier = NewECDSAVerifier(k)
+		default:
+			return nil, badKey
+		}
+	default:
+		return nil, fmt.Errorf("qsign: unsupported algorithm %q", alg)
+	}
+
+	return NewQsign(options), nil
+}
+
+// contentDigest returns the base64 digest of the body of req by alg.
+func contentDigest(req *http.Request, alg string) (string, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := contentDigestQsigns[alg].SignBytes(body)
+	return string(digest), err
+}
+
+// verifyContentDigest checks the body of req against its "Content-Digest" header. Digests of
+// unknown algorithms are ignored, but at least one must be known.
+func verifyContentDigest(req *http.Request) error {
+	digests, err := parseSFDictionary(strings.Join(req.Header["Content-Digest"], ", "))
+	if err != nil {
+		return err
+	}
+
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return err
+	}
+
+	checked := false
+	for alg, q := range contentDigestQsigns {
+		item, ok := digests[alg]
+		if !ok {
+			continue
+		}
+		digest, ok := item.value.([]byte)
+		if !ok {
+			return fmt.Errorf("%w: invalid content digest", ErrSignatureMismatch)
+		}
+
+		if err := q.VerifyBytes(body, []byte(base64.StdEncoding.EncodeToString(digest))); err != nil {
+			return fmt.Errorf("%w: content digest mismatch", ErrSignatureMismatch)
+		}
+		checked = true
+	}
+
+	if !checked {
+		return fmt.Errorf("%w: no supported content digest", ErrSignatureMismatch)
+	}
+	return nil
+}
+
+// readBody reads body, which is the body of a request or a response, and restores it for
+// reading again.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+
+	b, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = ioutil.NopCloser(bytes.NewReader(b))
+
+	return b, nil
+}
+
+// paramString returns string parameter key of item.
+func paramString(item *sfItem, key string) (string, bool) {
+	p, ok := item.param(key)
+	if !ok {
+		return "", false
+	}
+	s, ok := p.(string)
+	return s, ok
+}
+
+// isSFKey checks if s is a key of structured field values.
+func isSFKey(s string) bool {
+	p := &sfParser{s: s}
+	key, err := p.parseKey()
+	return err == nil && key == s
+}
@@ -0,0 +1,327 @@
+package qsign
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 9421 test key "test-shared-secret"
+const httpSigSecretForTest = "uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ=="
+
+// newHTTPSigRequestForTest returns the sample request of RFC 9421.
+func newHTTPSigRequestForTest() *http.Request {
+	body := `{"hello": "world"}`
+	req, _ := http.NewRequest("POST", "https://example.com/foo?param=Value&Pet=dog", strings.NewReader(body))
+	req.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Digest", "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:")
+	req.Header.Set("Content-Length", "18")
+	return req
+}
+
+func httpSigSecretResolverForTest(keyID string) (string, interface{}, error) {
+	if keyID != "test-shared-secret" {
+		return "", nil, errors.New("unknown key")
+	}
+	secret, _ := base64.StdEncoding.DecodeString(httpSigSecretForTest)
+	return HTTPSigHMACSHA256, secret, nil
+}
+
+func TestHTTPSignerHMAC(t *testing.T) {
+	// sample from RFC 9421, section B.2.5
+	secret, _ := base64.StdEncoding.DecodeString(httpSigSecretForTest)
+	s, err := NewHTTPSigner("sig-b25", "test-shared-secret", HTTPSigHMACSHA256, secret, []string{"date", "@authority", "content-type"})
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	s.now = func() time.Time { return time.Unix(1618884473, 0) }
+
+	req := newHTTPSigRequestForTest()
+	if err := s.Sign(req); err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+
+	expect := `sig-b25=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`
+	if actual := req.Header.Get("Signature-Input"); actual != expect {
+		t.Errorf("expect Signature-Input is %s, actual is %s", expect, actual)
+	}
+
+	expect = "sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:"
+	if actual := req.Header.Get("Signature"); actual != expect {
+		t.Errorf("expect Signature is %s, actual is %s", expect, actual)
+	}
+}
+
+func TestHTTPSigBase(t *testing.T) {
+	req := newHTTPSigRequestForTest()
+	req.Header.Add("X-Multi", " a ")
+	req.Header.Add("X-Multi", "b")
+	input := &sfItem{
+		value: []*sfItem{
+			{value: "@method"}, {value: "@authority"}, {value: "@scheme"}, {value: "@target-uri"},
+			{value: "@request-target"}, {value: "@path"}, {value: "@query"}, {value: "x-multi"},
+		},
+		params: []sfParam{{key: "created", value: int64(1618884473)}},
+	}
+
+	actual, err := httpSigBase(req, input)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+
+	expect := `"@method": POST
+"@authority": example.com
+"@scheme": https
+"@target-uri": https://example.com/foo?param=Value&Pet=dog
+"@request-target": /foo?param=Value&Pet=dog
+"@path": /foo
+"@query": ?param=Value&Pet=dog
+"x-multi": a, b
+"@signature-params": ("@method" "@authority" "@scheme" "@target-uri" "@request-target" "@path" "@query" "x-multi");created=1618884473`
+	if string(actual) != expect {
+		t.Errorf("expect signature base is\n%s\nactual is\n%s", expect, actual)
+	}
+
+	cases := []*sfItem{
+		{value: []*sfItem{{value: "x-missing"}}},
+		{value: []*sfItem{{value: "@status"}}},
+		{value: []*sfItem{{value: "date"}, {value: "date"}}},
+		{value: []*sfItem{{value: "date", params: []sfParam{{key: "sf", value: true}}}}},
+		{value: []*sfItem{{value: sfToken("date")}}},
+	}
+	for _, c := range cases {
+		if _, err := httpSigBase(req, c); err == nil {
+			t.Errorf("%s expect error, actual nil", c.serialize())
+		}
+	}
+}
+
+func TestHTTPVerifierRFCSample(t *testing.T) {
+	// signature of RFC 9421, section B.2.5, sent to a server
+	req := newHTTPSigRequestForTest()
+	req.URL.Scheme = ""
+	req.URL.Host = ""
+	req.Header.Set("Signature-Input", `sig-b25=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`)
+	req.Header.Set("Signature", "sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:")
+
+	v := NewHTTPVerifier(httpSigSecretResolverForTest, 0, []string{"@authority"})
+	keyID, err := v.Verify(req, "sig-b25")
+	if err != nil {
+		t.Errorf("expect no error, actual %v", err)
+	}
+	if keyID != "test-shared-secret" {
+		t.Errorf("expect key ID is test-shared-secret, actual is %s", keyID)
+	}
+
+	if err := verifyContentDigest(req); err != nil {
+		t.Errorf("expect sha-512 content digest is valid, actual %v", err)
+	}
+
+	req.Header.Set("Content-Type", "text/plain")
+	if _, err := v.Verify(req, "sig-b25"); err != ErrSignatureMismatch {
+		t.Errorf("expect signature mismatch, actual %v", err)
+	}
+}
+
+func TestHTTPSignVerify(t *testing.T) {
+	rsaKey := testRSAKey(t)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("expect no error generating ECDSA key, actual %v", err)
+	}
+
+	cases := []struct {
+		alg     string
+		signKey interface{}
+		pubKey  interface{}
+	}{
+		{HTTPSigHMACSHA256, []byte("secret"), []byte("secret")},
+		{HTTPSigRSAV15SHA256, rsaKey, &rsaKey.PublicKey},
+		{HTTPSigRSAPSSSHA512, rsaKey, &rsaKey.PublicKey},
+		{HTTPSigECDSAP256SHA256, ecKey, &ecKey.PublicKey},
+	}
+
+	components := []string{"@method", "@path", "@query", "Content-Type", "content-digest"}
+	now := time.Unix(1618884473, 0)
+
+	for _, c := range cases {
+		s, err := NewHTTPSigner("sig1", "key-"+c.alg, c.alg, c.signKey, components)
+		if err != nil {
+			t.Fatalf("%s expect no error, actual %v", c.alg, err)
+		}
+		s.now = func() time.Time { return now }
+
+		req, _ := http.NewRequest("POST", "https://example.com/foo?a=1", strings.NewReader(`{"hello": "world"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if err := s.Sign(req); err != nil {
+			t.Fatalf("%s expect no error, actual %v", c.alg, err)
+		}
+
+		expect := "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:"
+		if actual := req.Header.Get("Content-Digest"); actual != expect {
+			t.Errorf("%s expect Content-Digest is %s, actual is %s", c.alg, expect, actual)
+		}
+		if body, _ := ioutil.ReadAll(req.Body); string(body) != `{"hello": "world"}` {
+			t.Errorf("%s expect body is restored, actual %s", c.alg, body)
+		}
+		req.Body = ioutil.NopCloser(strings.NewReader(`{"hello": "world"}`))
+
+		resolve := func(keyID string) (string, interface{}, error) {
+			return c.alg, c.pubKey, nil
+		}
+		v := NewHTTPVerifier(resolve, time.Minute, components)
+		v.now = func() time.Time { return now.Add(time.Second) }
+
+		if _, err := v.Verify(req, "sig1"); err != nil {
+			t.Errorf("%s expect no error, actual %v", c.alg, err)
+		}
+
+		req.Body = ioutil.NopCloser(strings.NewReader(`{"hello": "tampered"}`))
+		if _, err := v.Verify(req, "sig1"); !errors.Is(err, ErrSignatureMismatch) {
+			t.Errorf("%s expect content digest mismatch, actual %v", c.alg, err)
+		}
+
+		req.Body = ioutil.NopCloser(strings.NewReader(`{"hello": "world"}`))
+		req.URL.RawQuery = "a=2"
+		if _, err := v.Verify(req, "sig1"); err != ErrSignatureMismatch {
+			t.Errorf("%s expect signature mismatch, actual %v", c.alg, err)
+		}
+	}
+}
+
+func TestHTTPVerifierError(t *testing.T) {
+	now := time.Unix(1618884473, 0)
+	secret, _ := base64.StdEncoding.DecodeString(httpSigSecretForTest)
+	s, _ := NewHTTPSigner("sig1", "test-shared-secret", HTTPSigHMACSHA256, secret, []string{"@method"})
+	s.now = func() time.Time { return now }
+
+	cases := []struct {
+		name     string
+		input    string
+		label    string
+		maxAge   time.Duration
+		required []string
+		at       time.Time
+		expect   error
+	}{
+		{"no label", "", "sig2", 0, nil, now, ErrSignatureMismatch},
+		{"too old", "", "sig1", time.Minute, nil, now.Add(2 * time.Minute), ErrExpired},
+		{"expired", `sig1=("@method");created=1618884473;expires=1618884474;keyid="test-shared-secret"`, "sig1", 0, nil, now.Add(2 * time.Second), ErrExpired},
+		{"no created", `sig1=("@method");keyid="test-shared-secret"`, "sig1", time.Minute, nil, now, ErrSignatureMismatch},
+		{"invalid created", `sig1=("@method");created="now";keyid="test-shared-secret"`, "sig1", 0, nil, now, ErrSignatureMismatch},
+		{"future", "", "sig1", time.Minute, nil, now.Add(-2 * time.Minute), ErrExpired},
+		{"far future", `sig1=("@method");created=4102444800;keyid="test-shared-secret"`, "sig1", 0, nil, now, ErrExpired},
+		{"no key ID", `sig1=("@method");created=1618884473`, "sig1", 0, nil, now, ErrSignatureMismatch},
+		{"unknown key", `sig1=("@method");created=1618884473;keyid="unknown"`, "sig1", 0, nil, now, nil},
+		{"algorithm", `sig1=("@method");created=1618884473;keyid="test-shared-secret";alg="rsa-pss-sha512"`, "sig1", 0, nil, now, ErrSignatureMismatch},
+		{"not covered", "", "sig1", 0, []string{"@method", "@path"}, now, ErrSignatureMismatch},
+		{"not inner list", `sig1="@method";keyid="test-shared-secret"`, "sig1", 0, nil, now, ErrSignatureMismatch},
+		{"invalid", `sig1=(`, "sig1", 0, nil, now, nil},
+	}
+
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "https://example.com/", nil)
+		if err := s.Sign(req); err != nil {
+			t.Fatalf("%s expect no error, actual %v", c.name, err)
+		}
+		if len(c.input) > 0 {
+			req.Header.Set("Signature-Input", c.input)
+		}
+
+		v := NewHTTPVerifier(httpSigSecretResolverForTest, c.maxAge, c.required)
+		v.now = func() time.Time { return c.at }
+		_, err := v.Verify(req, c.label)
+		if err == nil {
+			t.Errorf("%s expect error, actual nil", c.name)
+		}
+		if c.expect != nil && !errors.Is(err, c.expect) {
+			t.Errorf("%s expect %v, actual %v", c.name, c.expect, err)
+		}
+	}
+}
+
+func TestHTTPVerifierClockSkew(t *testing.T) {
+	now := time.Unix(1618884473, 0)
+	secret, _ := base64.StdEncoding.DecodeString(httpSigSecretForTest)
+	s, _ := NewHTTPSigner("sig1", "test-shared-secret", HTTPSigHMACSHA256, secret, []string{"@method"})
+	s.now = func() time.Time { return now }
+
+	req, _ := http.NewRequest("GET", "https://example.com/", nil)
+	if err := s.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+
+	v := NewHTTPVerifier(httpSigSecretResolverForTest, time.Minute, nil)
+	lenient := v.WithClockSkew(5 * time.Minute)
+
+	cases := []struct {
+		v      *HTTPVerifier
+		at     time.Time
+		expect error
+	}{
+		{v, now.Add(-DefaultHTTPSigClockSkew), nil},
+		{v, now.Add(-DefaultHTTPSigClockSkew - time.Second), ErrExpired},
+		{lenient, now.Add(-5 * time.Minute), nil},
+		{lenient, now.Add(-5*time.Minute - time.Second), ErrExpired},
+	}
+
+	for i, c := range cases {
+		at := c.at
+		c.v.now = func() time.Time { return at }
+		if _, err := c.v.Verify(req, "sig1"); err != c.expect {
+			t.Errorf("case %d: expect %v, actual %v", i, c.expect, err)
+		}
+	}
+}
+
+func TestNewHTTPSignerError(t *testing.T) {
+	rsaKey := testRSAKey(t)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	cases := []struct {
+		name  string
+		label string
+		alg   string
+		key   interface{}
+	}{
+		{"label", "Sig", HTTPSigHMACSHA256, []byte("secret")},
+		{"algorithm", "sig", "ed25519", []byte("secret")},
+		{"hmac key", "sig", HTTPSigHMACSHA256, "secret"},
+		{"rsa key", "sig", HTTPSigRSAV15SHA256, []byte("secret")},
+		{"public key", "sig", HTTPSigRSAPSSSHA512, &rsaKey.PublicKey},
+		{"curve", "sig", HTTPSigECDSAP256SHA256, ecKey},
+	}
+
+	for _, c := range cases {
+		if _, err := NewHTTPSigner(c.label, "key", c.alg, c.key, []string{"@method"}); err == nil {
+			t.Errorf("%s expect error, actual nil", c.name)
+		}
+	}
+}
+
+func TestHTTPSignMultiple(t *testing.T) {
+	s1, _ := NewHTTPSigner("sig1", "k1", HTTPSigHMACSHA256, []byte("s1"), []string{"@method"})
+	s2, _ := NewHTTPSigner("sig2", "k2", HTTPSigHMACSHA256, []byte("s2"), []string{"@path"})
+
+	req, _ := http.NewRequest("GET", "https://example.com/foo", nil)
+	s1.Sign(req)
+	s2.Sign(req)
+
+	resolve := func(keyID string) (string, interface{}, error) {
+		return HTTPSigHMACSHA256, []byte("s" + keyID[1:]), nil
+	}
+	v := NewHTTPVerifier(resolve, 0, nil)
+	for _, label := range []string{"sig1", "sig2"} {
+		if _, err := v.Verify(req, label); err != nil {
+			t.Errorf("%s expect no error, actual %v", label, err)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package qsign
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// TimestampFormat is the format of timestamps injected by SignInject and checked by Verify.
+type TimestampFormat int
+
+// Timestamp formats.
+const (
+	// UnixSeconds formats timestamps as Unix time in seconds, like "1554208460".
+	UnixSeconds TimestampFormat = iota
+
+	// UnixMillis formats timestamps as Unix time in milliseconds, like "1554208460000".
+	UnixMillis
+
+	// RFC3339 formats timestamps like "2019-04-02T12:34:20Z", in UTC.
+	RFC3339
+)
+
+const (
+	// DefaultNonceLength is the default length of injected nonces.
+	DefaultNonceLength = 32
+
+	// DefaultNonceAlphabet is the default alphabet of injected nonces.
+	DefaultNonceAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// format formats t.
+func (f TimestampFormat) format(t time.Time) string {
+	switch f {
+	case UnixMillis:
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	case RFC3339:
+		return t.UTC().Format(time.RFC3339)
+	default:
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+}
+
+// parse parses timestamp s.
+func (f TimestampFormat) parse(s string) (time.Time, error) {
+	switch f {
+	case RFC3339:
+		return time.Parse(time.RFC3339, s)
+	default:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if f == UnixMillis {
+			return time.Unix(0, n*int64(time.Millisecond)), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+}
+
+// kind returns the kind of timestamps in canonical JSON.
+func (f TimestampFormat) kind() valueKind {
+	if f == RFC3339 {
+		return stringKind
+	}
+	return numberKind
+}
+
+// SignInject is like Sign, but injects the current time under TimestampKey and a random nonce
+// under NonceKey before signing, and returns the injected values by key so they can be sent
+// with the signature. Fields of v with the same keys are replaced in the digest.
+//
+// The timestamp is formatted by TimestampFormat. The nonce has NonceLength characters from
+// NonceAlphabet, read from Rand.
+func (q *Qsign) SignInject(v interface{}) ([]byte, map[string]string, error) {
+	if len(q.timestampKey) == 0 && len(q.nonceKey) == 0 {
+		return nil, nil, configError("TimestampKey", "no timestamp or nonce key to inject")
+	}
+
+	injected := map[string]string{}
+	var fields []*field
+
+	if len(q.timestampKey) > 0 {
+		ts := q.timestampFormat.format(q.clock())
+		injected[q.timestampKey] = ts
+		fields = append(fields, &field{name: q.timestampKey, value: ts, kind: q.timestampFormat.kind()})
+	}
+
+	if len(q.nonceKey) > 0 {
+		nonce, err := randomString(q.rand, q.nonceAlphabet, q.nonceLength)
+		if err != nil {
+			return nil, nil, err
+		}
+		injected[q.nonceKey] = nonce
+		fields = append(fields, &field{name: q.nonceKey, value: nonce})
+	}
+
+	signature, err := q.signFields(context.Background(), v, fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signature, injected, nil
+}
+
+// inject replaces fields in vs by the keys of injected ones, keeping them sorted by key.
+func inject(vs []*field, injected []*field) []*field {
+	if len(injected) == 0 {
+		return vs
+	}
+
+	keys := map[string]bool{}
+	for _, f := range injected {
+		keys[f.name] = true
+	}
+
+	merged := make([]*field, 0, len(vs)+len(injected))
+	for _, f := range vs {
+		if !keys[f.name] {
+			merged = append(merged, f)
+		}
+	}
+	merged = append(merged, injected...)
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].name < merged[j].name
+	})
+	return merged
+}
+
+// randomString returns a string of n characters from alphabet, read from r. Bytes which would
+// bias the result are skipped.
+func randomString(r io.Reader, alphabet string, n int) (string, error) {
+	if err := validateNonceAlphabet(alphabet); err != nil {
+		return "", err
+	}
+	if n < 0 {
+		return "", configError("NonceLength", "invalid nonce length %d", n)
+	}
+
+	chars := []rune(alphabet)
+	limit := 256 - 256%len(chars)
+	s := make([]rune, 0, n)
+	buf := make([]byte, n)
+	for len(s) < n {
+		b := buf[:n-len(s)]
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		for _, b := range b {
+			if int(b) < limit {
+				s = append(s, chars[int(b)%len(chars)])
+			}
+		}
+	}
+	return string(s), nil
+}
+
+// validateNonceAlphabet checks if alphabet is valid UTF-8 of 1 to 256 distinct characters, so
+// each character of nonces is equally likely.
+func validateNonceAlphabet(alphabet string) error {
+	if !utf8.ValidString(alphabet) {
+		return configError("NonceAlphabet", "nonce alphabet is not valid UTF-8")
+	}
+	n := utf8.RuneCountInString(alphabet)
+	if n == 0 || n > 256 {
+		return configError("NonceAlphabet", "invalid nonce alphabet of %d characters", n)
+	}
+
+	seen := make(map[rune]bool, n)
+	for _, c := range alphabet {
+		if seen[c] {
+			return configError("NonceAlphabet", "duplicate character %q in nonce alphabet", c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package qsign
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestQsignSignInject(t *testing.T) {
+	now := time.Date(2019, 4, 2, 12, 34, 20, 500000000, time.UTC)
+	rand := bytes.NewReader([]byte{0, 1, 2, 61, 248, 255, 10, 36})
+
+	q := NewQsign(Options{
+		TimestampKey: "timestamp",
+		NonceKey:     "nonce_str",
+		NonceLength:  6,
+		Clock: func() time.Time {
+			return now
+		},
+		Rand: rand,
+	})
+
+	data := struct {
+		AppID     string `qsign:"appid"`
+		Timestamp string `qsign:"timestamp"`
+	}{"wxd930ea5d5a258f4f", "stale"}
+
+	signature, injected, err := q.SignInject(data)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+
+	// 248 and 255 are skipped to avoid bias
+	expect := map[string]string{"timestamp": "1554208460", "nonce_str": "012zAa"}
+	if injected["timestamp"] != expect["timestamp"] || injected["nonce_str"] != expect["nonce_str"] || len(injected) != 2 {
+		t.Errorf("expect injected %v, actual %v", expect, injected)
+	}
+
+	params := map[string]string{"appid": "wxd930ea5d5a258f4f", "timestamp": "1554208460", "nonce_str": "012zAa"}
+	if err := q.Verify(params, signature); err != nil {
+		t.Errorf("expect injected values are signed, actual %v", err)
+	}
+
+	if _, _, err := q.SignInject(data); err == nil {
+		t.Errorf("expect error when rand is exhausted, actual nil")
+	}
+
+	if _, _, err := NewQsign(Options{}).SignInject(data); err == nil {
+		t.Errorf("expect error without keys, actual nil")
+	}
+}
+
+func TestQsignSignInjectDefaults(t *testing.T) {
+	q := NewQsign(Options{NonceKey: "nonce"})
+
+	_, injected, err := q.SignInject(map[string]string{"a": "1"})
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+
+	nonce := injected["nonce"]
+	if len(nonce) != DefaultNonceLength {
+		t.Errorf("expect nonce has %d characters, actual %s", DefaultNonceLength, nonce)
+	}
+	for _, c := range nonce {
+		if !strings.ContainsRune(DefaultNonceAlphabet, c) {
+			t.Errorf("expect nonce %s is alphanumeric", nonce)
+		}
+	}
+
+	_, another, _ := q.SignInject(map[string]string{"a": "1"})
+	if another["nonce"] == nonce {
+		t.Errorf("expect nonces are random, actual %s twice", nonce)
+	}
+}
+
+func TestTimestampFormat(t *testing.T) {
+	now := time.Date(2019, 4, 2, 12, 34, 20, 500000000, time.UTC)
+
+	cases := []struct {
+		format TimestampFormat
+		expect string
+		parsed time.Time
+	}{
+		{UnixSeconds, "1554208460", time.Unix(1554208460, 0)},
+		{UnixMillis, "1554208460500", now},
+		{RFC3339, "2019-04-02T12:34:20Z", time.Unix(1554208460, 0)},
+	}
+
+	for _, c := range cases {
+		actual := c.format.format(now.In(time.FixedZone("CST", 8*3600)))
+		if actual != c.expect {
+			t.Errorf("expect %s, actual %s", c.expect, actual)
+		}
+
+		parsed, err := c.format.parse(actual)
+		if err != nil || !parsed.Equal(c.parsed) {
+			t.Errorf("expect %s parsed as %v, actual %v, %v", actual, c.parsed, parsed, err)
+		}
+
+		if _, err := c.format.parse("invalid"); err == nil {
+			t.Errorf("expect error parsing invalid timestamp")
+		}
+	}
+}
+
+func TestQsignSignInjectCanonicalJSON(t *testing.T) {
+	q := NewQsign(Options{
+		DigestMode:      CanonicalJSONDigest,
+		TimestampKey:    "ts",
+		TimestampFormat: UnixMillis,
+		Clock: func() time.Time {
+			return time.Unix(1554208460, 0)
+		},
+	})
+
+	fields := inject([]*field{{name: "a", value: "1"}, {name: "z", value: "2"}}, []*field{
+		{name: "ts", value: UnixMillis.format(q.clock()), kind: UnixMillis.kind()},
+	})
+
+	buf := new(bytes.Buffer)
+	if err := writeCanonicalJSON(buf, fields); err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	if expect := `{"a":"1","ts":1554208460000,"z":"2"}`; buf.String() != expect {
+		t.Errorf("expect %s, actual %s", expect, buf.String())
+	}
+
+	if _, _, err := q.SignInject(map[string]string{"a": "1"}); err != nil {
+		t.Errorf("expect no error, actual %v", err)
+	}
+}
+
+func TestRandomStringError(t *testing.T) {
+	if _, err := randomString(zeroReader{}, "", 8); err == nil {
+		t.Errorf("expect error for empty alphabet")
+	}
+	if _, err := randomString(zeroReader{}, "ab", -1); err == nil {
+		t.Errorf("expect error for negative length")
+	}
+	if s, err := randomString(zeroReader{}, "ab", 4); s != "aaaa" || err != nil {
+		t.Errorf("expect aaaa, actual %s, %v", s, err)
+	}
+
+	for _, alphabet := range []string{"aab", "ab\xff", strings.Repeat("a", 257)} {
+		if _, err := randomString(zeroReader{}, alphabet, 4); err == nil {
+			t.Errorf("expect error for alphabet %q", alphabet)
+		}
+	}
+}
+
+func TestRandomStringUnicode(t *testing.T) {
+	s, err := randomString(bytes.NewReader([]byte{0, 1, 2, 3, 4, 5}), "αβγ", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "αβγαβγ"; s != expect || !utf8.ValidString(s) {
+		t.Errorf("expect %s, actual %q", expect, s)
+	}
+}
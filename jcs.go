@@ -0,0 +1,142 @@
+package qsign
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// writeCanonicalJSON writes fields to buf as a JSON object serialized by the JSON
+// Canonicalization Scheme (RFC 8785). Members are sorted by the UTF-16 code units of their
+// keys, numbers are formatted like ECMAScript does, and strings are minimally escaped.
+func writeCanonicalJSON(buf *bytes.Buffer, fields []*field) error {
+	sorted := make([]*field, len(fields))
+	copy(sorted, fields)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return lessUTF16(sorted[i].name, sorted[j].name)
+	})
+
+	buf.WriteByte('{')
+	for i, f := range sorted {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		if err := writeCanonicalMember(buf, f); err != nil {
+			return &FieldError{Path: f.name, Err: err}
+		}
+	}
+	buf.WriteByte('}')
+
+	return nil
+}
+
+// writeCanonicalMember writes the key and the value of f to buf as a JSON object member.
+func writeCanonicalMember(buf *bytes.Buffer, f *field) error {
+	if err := writeCanonicalString(buf, f.name); err != nil {
+		return err
+	}
+	buf.WriteByte(':')
+
+	switch f.kind {
+	case numberKind:
+		n, err := canonicalNumber(f.value)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(n)
+	case boolKind:
+		buf.WriteString(f.value)
+	case nullKind:
+		buf.WriteString("null")
+	default:
+		return writeCanonicalString(buf, f.value)
+	}
+	return nil
+}
+
+// canonicalNumber formats the number in string s as an IEEE 754 double the way ECMAScript's
+// Number.prototype.toString does. Integers beyond 2^53 lose precision, as RFC 8785 requires.
+func canonicalNumber(s string) (string, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return "", err
+	}
+
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", errors.New("NaN and Infinity are not allowed in canonical JSON")
+	}
+
+	if f == 0 {
+		return "0", nil
+	}
+
+	abs := math.Abs(f)
+	if abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+
+	// ECMAScript has no leading zeros in exponent, e.g. 1e-7 rather than 1e-07
+	n := strconv.FormatFloat(f, 'e', -1, 64)
+	if i := len(n) - 2; n[i-2] == 'e' && n[i] == '0' {
+		n = n[:i] + n[i+1:]
+	}
+	return n, nil
+}
+
+// writeCanonicalString writes s to buf as a JSON string. Only quotation mark, reverse solidus
+// and control characters are escaped.
+func writeCanonicalString(buf *bytes.Buffer, s string) error {
+	if !utf8.ValidString(s) {
+		return errors.New("invalid UTF-8 string in canonical JSON")
+	}
+
+	const hex = "0123456789abcdef"
+
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[c>>4])
+				buf.WriteByte(hex[c&0xf])
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+
+	return nil
+}
+
+// lessUTF16 compares a and b by their UTF-16 code units.
+func lessUTF16(a, b string) bool {
+	ua := utf16.Encode([]rune(a))
+	ub := utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
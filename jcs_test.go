@@ -0,0 +1,113 @@
+package qsign
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestJCSCanonicalNumber(t *testing.T) {
+	// IEEE 754 samples from RFC 8785 Appendix B
+	cases := []struct {
+		input  uint64
+		expect string
+	}{
+		{0x0000000000000000, "0"},
+		{0x8000000000000000, "0"},
+		{0x0000000000000001, "5e-324"},
+		{0x8000000000000001, "-5e-324"},
+		{0x7fefffffffffffff, "1.7976931348623157e+308"},
+		{0xffefffffffffffff, "-1.7976931348623157e+308"},
+		{0x4340000000000000, "9007199254740992"},
+		{0xc340000000000000, "-9007199254740992"},
+		{0x4430000000000000, "295147905179352830000"},
+		{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+		{0x44b52d02c7e14af6, "1e+23"},
+		{0x3eb0c6f7a0b5ed8d, "0.000001"},
+		{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+		{0x41b3de4355555553, "333333333.3333332"},
+		{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+		{0x444b1ae4d6e2ef50, "1e+21"},
+	}
+
+	for _, c := range cases {
+		f := math.Float64frombits(c.input)
+		actual, err := canonicalNumber(strconv.FormatFloat(f, 'g', -1, 64))
+		if err != nil {
+			t.Errorf("expect %016x has no error, actual %v", c.input, err)
+		}
+		if actual != c.expect {
+			t.Errorf("expect %016x is formatted as %s, actual is %s", c.input, c.expect, actual)
+		}
+	}
+
+	for _, input := range []string{"NaN", "+Inf", "-Inf"} {
+		if _, err := canonicalNumber(input); err == nil {
+			t.Errorf("expect %s returns an error", input)
+		}
+	}
+}
+
+func TestJCSWriteCanonicalString(t *testing.T) {
+	cases := []struct {
+		input  string
+		expect string
+	}{
+		{"", `""`},
+		{"€$\u000f\nA'B\"\\\\\"/", `"€$\u000f\nA'B\"\\\\\"/"`},
+		{"\b\f\r\t\u001f\u007f<>&", "\"\\b\\f\\r\\t\\u001f\u007f<>&\""},
+	}
+
+	for _, c := range cases {
+		buf := new(bytes.Buffer)
+		if err := writeCanonicalString(buf, c.input); err != nil {
+			t.Errorf("expect %q has no error, actual %v", c.input, err)
+		}
+		if actual := buf.String(); actual != c.expect {
+			t.Errorf("expect %q is written as %s, actual is %s", c.input, c.expect, actual)
+		}
+	}
+
+	if err := writeCanonicalString(new(bytes.Buffer), "\xff"); err == nil {
+		t.Errorf("expect invalid UTF-8 string returns an error")
+	}
+}
+
+func TestJCSWriteCanonicalJSON(t *testing.T) {
+	// sorting sample from RFC 8785 section 3.2.3
+	fields := []*field{
+		{name: "€", value: "Euro Sign"},
+		{name: "\r", value: "Carriage Return"},
+		{name: "דּ", value: "Hebrew Letter Dalet With Dagesh"},
+		{name: "1", value: "One"},
+		{name: "\U0001f600", value: "Emoji: Grinning Face"},
+		{name: "\u0080", value: "Control"},
+		{name: "ö", value: "Latin Small Letter O With Diaeresis"},
+	}
+	expect := `{"\r":"Carriage Return","1":"One","` + "\u0080" + `":"Control","ö":"Latin Small Letter O With Diaeresis","€":"Euro Sign","` + "\U0001f600" + `":"Emoji: Grinning Face","` + "דּ" + `":"Hebrew Letter Dalet With Dagesh"}`
+
+	buf := new(bytes.Buffer)
+	if err := writeCanonicalJSON(buf, fields); err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	if actual := buf.String(); actual != expect {
+		t.Errorf("expect canonical JSON is %s, actual is %s", expect, actual)
+	}
+
+	fields = []*field{
+		{name: "numbers", value: "1e-07", kind: numberKind},
+		{name: "literals", value: "true", kind: boolKind},
+		{name: "string", value: "10", kind: stringKind},
+		{name: "null", kind: nullKind},
+	}
+	expect = `{"literals":true,"null":null,"numbers":1e-7,"string":"10"}`
+
+	buf.Reset()
+	if err := writeCanonicalJSON(buf, fields); err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	if actual := buf.String(); actual != expect {
+		t.Errorf("expect canonical JSON is %s, actual is %s", expect, actual)
+	}
+}
@@ -0,0 +1,217 @@
+package qsign
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"sync"
+	"time"
+)
+
+// Key is a secret with an ID, valid from NotBefore until NotAfter. A zero NotBefore means the
+// key is valid from the beginning, and a zero NotAfter means it never expires.
+type Key struct {
+	ID        string
+	Secret    string
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// valid checks if k is valid at t.
+func (k Key) valid(t time.Time) bool {
+	if !k.NotBefore.IsZero() && t.Before(k.NotBefore) {
+		return false
+	}
+	if !k.NotAfter.IsZero() && !t.Before(k.NotAfter) {
+		return false
+	}
+	return true
+}
+
+// KeyRing holds keys being rotated. It's safe for concurrent use, so keys can be added and
+// removed while it's used.
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys []Key
+}
+
+// NewKeyRing returns a *KeyRing holding keys.
+func NewKeyRing(keys ...Key) *KeyRing {
+	r := &KeyRing{}
+	r.Add(keys...)
+	return r
+}
+
+// Add adds keys to r, replacing those with the same IDs.
+func (r *KeyRing) Add(keys ...Key) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range keys {
+		r.remove(k.ID)
+		r.keys = append(r.keys, k)
+	}
+}
+
+// Remove removes the key with ID id from r.
+func (r *KeyRing) Remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.remove(id)
+}
+
+func (r *KeyRing) remove(id string) {
+	for i, k := range r.keys {
+		if k.ID == id {
+			r.keys = append(r.keys[:i], r.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+// Key returns the key with ID id.
+func (r *KeyRing) Key(id string) (Key, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, k := range r.keys {
+		if k.ID == id {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+// Active returns the key signing at t, which is the valid key activated last. Of keys activated
+// at the same time, the one added last wins.
+func (r *KeyRing) Active(t time.Time) (Key, bool) {
+	keys := r.Valid(t)
+	if len(keys) == 0 {
+		return Key{}, false
+	}
+	return keys[0], true
+}
+
+// Valid returns the keys valid at t, from the one activated last.
+func (r *KeyRing) Valid(t time.Time) []Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var keys []Key
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		if r.keys[i].valid(t) {
+			keys = append(keys, r.keys[i])
+		}
+	}
+
+	// insertion sort keeps keys activated at the same time in order
+	for i := 1; i < len(keys); i++ {
+		for j := i; j > 0 && keys[j].NotBefore.After(keys[j-1].NotBefore); j-- {
+			keys[j], keys[j-1] = keys[j-1], keys[j]
+		}
+	}
+	return keys
+}
+
+// withKey returns a copy of q applying key k by KeySuffix and KeyedHasher.
+func (q *Qsign) withKey(k Key) *Qsign {
+	kq := q.clone()
+	if q.keySuffix != nil {
+		kq.suffixGenerator = func(context.Context, []Pair) (string, error) {
+			return q.keySuffix(k.Secret), nil
+		}
+	}
+	if q.keyedHasher != nil {
+		kq.hasher = func() hash.Hash {
+			return q.keyedHasher([]byte(k.Secret))
+		}
+		kq.selectHasher = nil
+	}
+	return kq
+}
+
+// keyFor returns q applying the key to sign fields with. Without a KeyResolver or a KeyRing,
+// it's q itself.
+func (q *Qsign) keyFor(ctx context.Context, fields []*field) (*Qsign, error) {
+	if q.keyResolver != nil {
+		return q.resolveKey(ctx, fields)
+	}
+	if q.keyRing == nil {
+		return q, nil
+	}
+
+	if k, ok, err := q.namedKey(fields); ok || err != nil {
+		return q.withKey(k), err
+	}
+
+	k, ok := q.keyRing.Active(q.clock())
+	if !ok {
+		return nil, ErrInactiveKey
+	}
+	return q.withKey(k), nil
+}
+
+// namedKey returns the key named by the value of KeyIDKey in fields, if there is one.
+func (q *Qsign) namedKey(fields []*field) (Key, bool, error) {
+	if len(q.keyIDKey) == 0 {
+		return Key{}, false, nil
+	}
+
+	id, ok := fieldValue(fields, q.keyIDKey)
+	if !ok {
+		return Key{}, false, nil
+	}
+
+	k, ok := q.keyRing.Key(id)
+	if !ok {
+		return Key{}, false, &FieldError{Path: q.keyIDKey, Err: fmt.Errorf("unknown key %q", id)}
+	}
+	if !k.valid(q.clock()) {
+		return Key{}, false, fmt.Errorf("%w: %q", ErrInactiveKey, id)
+	}
+	return k, true, nil
+}
+
+// verifyKeys verifies signature of fields with each key which may sign them, and returns the
+// ID of the key verifying it. Checksums are calculated by sum for each key.
+func (q *Qsign) verifyKeys(ctx context.Context, fields []*field, signature []byte, sum func(kq *Qsign) ([]byte, error)) (string, error) {
+	if q.keyRing == nil || q.keyResolver != nil {
+		kq, err := q.keyFor(ctx, fields)
+		if err != nil {
+			return "", err
+		}
+
+		s, err := sum(kq)
+		if err != nil {
+			return "", err
+		}
+		return "", kq.verify(s, signature)
+	}
+
+	keys := q.keyRing.Valid(q.clock())
+	k, ok, err := q.namedKey(fields)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		keys = []Key{k}
+	}
+
+	for _, k := range keys {
+		kq := q.withKey(k)
+		s, err := sum(kq)
+		if err != nil {
+			return "", err
+		}
+
+		err = kq.verify(s, signature)
+		if err == nil {
+			return k.ID, nil
+		}
+		if err != ErrSignatureMismatch {
+			return "", err
+		}
+	}
+	return "", ErrSignatureMismatch
+}
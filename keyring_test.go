@@ -0,0 +1,237 @@
+package qsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKeyRing(t *testing.T) {
+	now := time.Unix(1554208460, 0)
+	r := NewKeyRing(
+		Key{ID: "always", Secret: "a"},
+		Key{ID: "old", Secret: "b", NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)},
+		Key{ID: "new", Secret: "c", NotBefore: now},
+		Key{ID: "future", Secret: "d", NotBefore: now.Add(time.Hour)},
+	)
+
+	cases := []struct {
+		at     time.Time
+		expect []string
+	}{
+		{now.Add(-2 * time.Hour), []string{"always"}},
+		{now.Add(-time.Second), []string{"old", "always"}},
+		{now, []string{"new", "old", "always"}},
+		{now.Add(time.Hour), []string{"future", "new", "always"}},
+	}
+
+	for _, c := range cases {
+		var ids []string
+		for _, k := range r.Valid(c.at) {
+			ids = append(ids, k.ID)
+		}
+		if !reflect.DeepEqual(ids, c.expect) {
+			t.Errorf("expect valid keys at %v are %v, actual %v", c.at, c.expect, ids)
+		}
+
+		active, ok := r.Active(c.at)
+		if !ok || active.ID != c.expect[0] {
+			t.Errorf("expect active key at %v is %s, actual %s", c.at, c.expect[0], active.ID)
+		}
+	}
+
+	r.Add(Key{ID: "new", Secret: "e", NotBefore: now})
+	if k, _ := r.Key("new"); k.Secret != "e" {
+		t.Errorf("expect key is replaced, actual %v", k)
+	}
+
+	r.Add(Key{ID: "newer", Secret: "f", NotBefore: now})
+	if active, _ := r.Active(now); active.ID != "newer" {
+		t.Errorf("expect key added last wins, actual %s", active.ID)
+	}
+
+	r.Remove("newer")
+	r.Remove("new")
+	r.Remove("always")
+	if _, ok := r.Key("new"); ok {
+		t.Errorf("expect key is removed")
+	}
+	if _, ok := r.Active(now.Add(-2 * time.Hour)); ok {
+		t.Errorf("expect no active key")
+	}
+}
+
+func TestQsignKeyRing(t *testing.T) {
+	now := time.Unix(1554208460, 0)
+	ring := NewKeyRing(
+		Key{ID: "2019a", Secret: "192006250b4c09247ec02edce69f6a2d", NotAfter: now.Add(time.Hour)},
+		Key{ID: "2019b", Secret: "0f8e3c0b4c09247ec02edce69f6a2d19", NotBefore: now},
+	)
+	q := NewQsign(Options{
+		KeyRing: ring,
+		KeySuffix: func(secret string) string {
+			return "&key=" + secret
+		},
+		Clock: func() time.Time {
+			return now
+		},
+	})
+
+	data := map[string]interface{}{
+		"appid":       "wxd930ea5d5a258f4f",
+		"mch_id":      10000100,
+		"device_info": "1000",
+		"body":        "test",
+		"nonce_str":   "ibuaiVcKdpRxkhJA",
+	}
+
+	// signed with the old key
+	keyID, err := q.VerifyKey(data, []byte("9a0a8659f005d6984697e2ca0a9cf3b7"))
+	if err != nil || keyID != "2019a" {
+		t.Errorf("expect verified with 2019a, actual %s, %v", keyID, err)
+	}
+
+	signature, err := q.Sign(data)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	if keyID, err := q.VerifyKey(data, signature); err != nil || keyID != "2019b" {
+		t.Errorf("expect signed with the active key 2019b, actual %s, %v", keyID, err)
+	}
+
+	digest, _ := q.Digest(data)
+	if expect := "&key=0f8e3c0b4c09247ec02edce69f6a2d19"; string(digest[len(digest)-len(expect):]) != expect {
+		t.Errorf("expect digest with the active key, actual %s", digest)
+	}
+
+	if _, err := q.VerifyKey(data, []byte("00000000000000000000000000000000")); err != ErrSignatureMismatch {
+		t.Errorf("expect signature mismatch, actual %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	if err := q.Verify(data, []byte("9a0a8659f005d6984697e2ca0a9cf3b7")); err != ErrSignatureMismatch {
+		t.Errorf("expect expired key is not used, actual %v", err)
+	}
+
+	ring.Remove("2019b")
+	if _, err := q.Sign(data); err != ErrInactiveKey {
+		t.Errorf("expect error without active key, actual %v", err)
+	}
+}
+
+func TestQsignKeyRingKeyID(t *testing.T) {
+	ring := NewKeyRing(
+		Key{ID: "k1", Secret: "secret1"},
+		Key{ID: "k2", Secret: "secret2", NotAfter: time.Unix(1, 0)},
+		Key{ID: "k3", Secret: "secret3"},
+	)
+	q := NewQsign(Options{
+		KeyRing:  ring,
+		KeyIDKey: "key_id",
+		KeyedHasher: func(secret []byte) hash.Hash {
+			return hmac.New(sha256.New, secret)
+		},
+	})
+
+	data := map[string]string{"a": "1", "key_id": "k1"}
+	signature, err := q.Sign(data)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+
+	h := hmac.New(sha256.New, []byte("secret1"))
+	h.Write([]byte("a=1&key_id=k1"))
+	expect := NewQsign(Options{})
+	if s, _ := expect.sign(h.Sum(nil)); string(s) != string(signature) {
+		t.Errorf("expect signed by HMAC with k1, actual %s", signature)
+	}
+
+	if keyID, err := q.VerifyKey(data, signature); err != nil || keyID != "k1" {
+		t.Errorf("expect verified with k1, actual %s, %v", keyID, err)
+	}
+
+	// k3 is active, but only the named key is tried
+	signed := map[string]string{"a": "1"}
+	signature, _ = q.Sign(signed)
+	signed["key_id"] = "k3"
+	if err := q.Verify(signed, signature); err != ErrSignatureMismatch {
+		t.Errorf("expect signature mismatch, actual %v", err)
+	}
+
+	var fe *FieldError
+	cases := []struct {
+		id       string
+		inactive bool
+	}{
+		{"k2", true},
+		{"unknown", false},
+	}
+	for _, c := range cases {
+		data := map[string]string{"a": "1", "key_id": c.id}
+		_, signErr := q.Sign(data)
+		_, verifyErr := q.VerifyKey(data, signature)
+		for _, err := range []error{signErr, verifyErr} {
+			if c.inactive && !errors.Is(err, ErrInactiveKey) {
+				t.Errorf("%s expect inactive key, actual %v", c.id, err)
+			}
+			if !c.inactive && (!errors.As(err, &fe) || fe.Path != "key_id") {
+				t.Errorf("%s expect unknown key, actual %v", c.id, err)
+			}
+		}
+	}
+}
+
+func TestQsignKeyRingSelectHasher(t *testing.T) {
+	q := NewQsign(Options{
+		KeyRing: NewKeyRing(Key{ID: "k1", Secret: "secret1"}),
+		KeyedHasher: func(secret []byte) hash.Hash {
+			return hmac.New(sha256.New, secret)
+		},
+	})
+	// like presets choosing the hasher by sign type
+	q.selectHasher = func([]*field) (Hasher, error) {
+		return defaultHasher, nil
+	}
+
+	signature, err := q.Sign(map[string]string{"a": "1"})
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+
+	h := hmac.New(sha256.New, []byte("secret1"))
+	h.Write([]byte("a=1"))
+	if expect, _ := q.sign(h.Sum(nil)); string(expect) != string(signature) {
+		t.Errorf("expect signed by the keyed hasher %s, actual %s", expect, signature)
+	}
+}
+
+func TestQsignKeyRingBytes(t *testing.T) {
+	ring := NewKeyRing(Key{ID: "k1", Secret: "secret1"})
+	q := NewQsign(Options{
+		KeyRing: ring,
+		KeyedHasher: func(secret []byte) hash.Hash {
+			return hmac.New(sha256.New, secret)
+		},
+	})
+
+	body := []byte(`{"a":1}`)
+	signature, err := q.SignBytes(body)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+
+	ring.Add(Key{ID: "k2", Secret: "secret2"})
+	if err := q.VerifyBytes(body, signature); err != nil {
+		t.Errorf("expect verified with the old key, actual %v", err)
+	}
+	if err := q.VerifyReader(errReader{}, signature); err == nil {
+		t.Errorf("expect read error is returned")
+	}
+	if err := q.VerifyBytes(body, []byte("bad")); err != ErrSignatureMismatch {
+		t.Errorf("expect signature mismatch, actual %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package qsign
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"hash"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OAuth1Signer signs requests by OAuth 1.0a using HMAC-SHA1 (RFC 5849).
+type OAuth1Signer struct {
+	consumerKey string
+	token       string
+	q           *Qsign
+
+	// now and nonce generate "oauth_timestamp" and "oauth_nonce", replaced in tests.
+	now   func() time.Time
+	nonce func() (string, error)
+}
+
+// NewOAuth1Signer returns a *OAuth1Signer signing requests with the consumer credentials and
+// the token credentials. token and tokenSecret are empty if no token is issued yet.
+func NewOAuth1Signer(consumerKey, consumerSecret, token, tokenSecret string) *OAuth1Signer {
+	key := []byte(escapeRFC3986(consumerSecret) + "&" + escapeRFC3986(tokenSecret))
+
+	return &OAuth1Signer{
+		consumerKey: consumerKey,
+		token:       token,
+		q: NewQsign(Options{
+			Hasher: func() hash.Hash {
+				return hmac.New(sha1.New, key)
+			},
+			Encoder: base64Encoder,
+		}),
+		now:   time.Now,
+		nonce: randomHex,
+	}
+}
+
+// Sign sets the "Authorization: OAuth ..." header of req. Query parameters of req are signed,
+// and so are parameters of the body if its content type is "application/x-www-form-urlencoded".
+// The body is read and restored for sending.
+func (s *OAuth1Signer) Sign(req *http.Request) error {
+	var form url.Values
+	if req.Body != nil && isFormContent(req.Header.Get("Content-Type")) {
+		body, err := readBody(&req.Body)
+		if err != nil {
+			return err
+		}
+
+		if form, err = url.ParseQuery(string(body)); err != nil {
+			return err
+		}
+	}
+
+	authorization, err := s.Authorization(req.Method, req.URL, form)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", authorization)
+	return nil
+}
+
+// Authorization returns the value of the Authorization header of a request to u, with form
+// parameters form in the body. The oauth_* parameters, the query parameters of u and form
+// are merged and normalized, and the signature base string is built as
+// "METHOD&escape(base URL)&escape(normalized parameters)".
+func (s *OAuth1Signer) Authorization(method string, u *url.URL, form url.Values) (string, error) {
+	nonce, err := s.nonce()
+	if err != nil {
+		return "", err
+	}
+
+	oauth := url.Values{
+		"oauth_consumer_key":     {s.consumerKey},
+		"oauth_nonce":            {nonce},
+		"oauth_signature_method": {"HMAC-SHA1"},
+		"oauth_timestamp":        {strconv.FormatInt(s.now().Unix(), 10)},
+		"oauth_version":          {"1.0"},
+	}
+	if len(s.token) > 0 {
+		oauth.Set("oauth_token", s.token)
+	}
+
+	params := url.Values{}
+	for _, vs := range []url.Values{oauth, u.Query(), form} {
+		for k, v := range vs {
+			params[k] = append(params[k], v...)
+		}
+	}
+
+	baseString := strings.ToUpper(method) + "&" + escapeRFC3986(oauth1BaseURL(u)) + "&" + escapeRFC3986(CanonicalQuery(params))
+
+	signature, err := s.q.SignBytes([]byte(baseString))
+	if err != nil {
+		return "", err
+	}
+	oauth.Set("oauth_signature", string(signature))
+
+	keys := make([]string, 0, len(oauth))
+	for k := range oauth {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = escapeRFC3986(k) + `="` + escapeRFC3986(oauth.Get(k)) + `"`
+	}
+
+	return "OAuth " + strings.Join(pairs, ", "), nil
+}
+
+// oauth1BaseURL returns the base string URI of u, with lowercase scheme and host, without
+// default port, query and fragment.
+func oauth1BaseURL(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Host)
+	if scheme == "http" && strings.HasSuffix(host, ":80") {
+		host = strings.TrimSuffix(host, ":80")
+	} else if scheme == "https" && strings.HasSuffix(host, ":443") {
+		host = strings.TrimSuffix(host, ":443")
+	}
+
+	path := u.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+
+	return scheme + "://" + host + path
+}
+
+// isFormContent checks if content type contentType is "application/x-www-form-urlencoded".
+func isFormContent(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+// randomHex returns 16 random bytes encoded as hex.
+func randomHex() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
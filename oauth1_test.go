@@ -0,0 +1,100 @@
+package qsign
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTwitterOAuth1Signer returns the signer of the sample in Twitter API documentation.
+func newTwitterOAuth1Signer() *OAuth1Signer {
+	s := NewOAuth1Signer(
+		"xvz1evFS4wEEPTGEFPHBog",
+		"kAcSOqF21Fu85e7zjz7ZN2U4ZRhfV3WpwPAoE3Z7kBw",
+		"370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb",
+		"LswwdoUaIvS8ltyTt5jkRh4J50vUPVVHtR2YPi5kE",
+	)
+	s.now = func() time.Time {
+		return time.Unix(1318622958, 0)
+	}
+	s.nonce = func() (string, error) {
+		return "kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg", nil
+	}
+	return s
+}
+
+const twitterOAuth1Authorization = `OAuth oauth_consumer_key="xvz1evFS4wEEPTGEFPHBog", oauth_nonce="kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg", oauth_signature="hCtSmYh%2BiHYCEqBWrE7C7hYmtUk%3D", oauth_signature_method="HMAC-SHA1", oauth_timestamp="1318622958", oauth_token="370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb", oauth_version="1.0"`
+
+func TestOAuth1Authorization(t *testing.T) {
+	s := newTwitterOAuth1Signer()
+
+	u, _ := url.Parse("https://API.Twitter.com:443/1.1/statuses/update.json?include_entities=true")
+	form := url.Values{"status": {"Hello Ladies + Gentlemen, a signed OAuth request!"}}
+
+	actual, err := s.Authorization("post", u, form)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	if actual != twitterOAuth1Authorization {
+		t.Errorf("expect authorization is %s, actual is %s", twitterOAuth1Authorization, actual)
+	}
+
+	s.nonce = func() (string, error) {
+		return "", errors.New("no entropy")
+	}
+	if _, err := s.Authorization("POST", u, form); err == nil {
+		t.Errorf("expect nonce error is returned")
+	}
+}
+
+func TestOAuth1Sign(t *testing.T) {
+	s := newTwitterOAuth1Signer()
+
+	body := "status=Hello%20Ladies%20%2b%20Gentlemen%2c%20a%20signed%20OAuth%20request%21"
+	req, _ := http.NewRequest("POST", "https://api.twitter.com/1.1/statuses/update.json?include_entities=true", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	if err := s.Sign(req); err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	if actual := req.Header.Get("Authorization"); actual != twitterOAuth1Authorization {
+		t.Errorf("expect authorization is %s, actual is %s", twitterOAuth1Authorization, actual)
+	}
+
+	restored, _ := ioutil.ReadAll(req.Body)
+	if string(restored) != body {
+		t.Errorf("expect body is restored as %s, actual is %s", body, restored)
+	}
+
+	// JSON bodies are not signed
+	req, _ = http.NewRequest("POST", "https://api.twitter.com/1.1/statuses/update.json?include_entities=true", strings.NewReader(`{"status":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if err := s.Sign(req); err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	if actual := req.Header.Get("Authorization"); actual == twitterOAuth1Authorization {
+		t.Errorf("expect authorization differs without form parameters")
+	}
+}
+
+func TestOAuth1BaseURL(t *testing.T) {
+	cases := []struct {
+		input  string
+		expect string
+	}{
+		{"HTTP://Example.com:80/r%20v/X?id=123", "http://example.com/r%20v/X"},
+		{"https://www.example.net:8080/?q=1", "https://www.example.net:8080/"},
+		{"https://example.com", "https://example.com/"},
+	}
+
+	for _, c := range cases {
+		u, _ := url.Parse(c.input)
+		if actual := oauth1BaseURL(u); actual != c.expect {
+			t.Errorf("expect base URL of %s is %s, actual is %s", c.input, c.expect, actual)
+		}
+	}
+}
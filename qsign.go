@@ -2,24 +2,62 @@ package qsign
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// Qsign is the signer which signs structs.
+// Qsign is the signer which signs structs. It's immutable once built, so it's safe for
+// concurrent use. With methods like WithDelimiter return derived copies, which aren't
+// validated until Validate is called.
 type Qsign struct {
-	prefixGenerator Generator
-	suffixGenerator Generator
+	prefixGenerator PairsGenerator
+	suffixGenerator PairsGenerator
 	encoder         Encoder
 	filter          Filter
 	hasher          Hasher
 	delimiter       string
 	connector       string
+	strictKeys      bool
+	mode            DigestMode
+	signer          Signer
+	verifier        Verifier
+	timestampKey    string
+	nonceKey        string
+	tolerance       time.Duration
+	nonceStore      NonceStore
+	clock           func() time.Time
+	timestampFormat TimestampFormat
+	nonceLength     int
+	nonceAlphabet   string
+	rand            io.Reader
+	keyRing         *KeyRing
+	keyIDKey        string
+	keySuffix       func(secret string) string
+	keyedHasher     func(secret []byte) hash.Hash
+	keyResolver     ContextKeyResolver
+
+	// selectHasher chooses the hasher by the filtered fields being signed, overriding hasher.
+	// It's cleared once the hasher is replaced by WithHasher or a keyed hasher.
+	selectHasher func(fields []*field) (Hasher, error)
 }
 
 // Options is optional attributes for building NewSign function to build *Qsign.
 //
 // PrefixGenerator and SuffixGenerator is two functions which you can use to generating
 // prefix string prepending to digest and suffix string appending to digest string.
+// ContextPrefixGenerator and ContextSuffixGenerator are like them, but receive the context of
+// SignContext, DigestContext and VerifyContext, and may return errors. They override
+// PrefixGenerator and SuffixGenerator if given. PairsPrefixGenerator and PairsSuffixGenerator
+// receive the pairs being signed as well, and override all the other generators.
+//
+// Delimiter and Connector connect key-value pairs in the digest, like "&" and "=" by default.
 //
 // Filter is a function used to get rid of some keys or values. For example you want
 // a field which its value is empty being ignored. And this is the default filter.
@@ -30,12 +68,75 @@ type Qsign struct {
 //
 // Hasher is a function which returns hash.Hash. By default it returns the Hash from
 // crypto/md5.
+//
+// StrictKeys makes Digest return an error if more than one field produces the same key. By
+// default, duplicate keys are resolved like encoding/json does: the field with the shallowest
+// embedding depth wins, a tagged field beats untagged ones, and the key is dropped if there
+// is still a tie.
+//
+// DigestMode selects how key-value pairs are serialized. By default they are connected like
+// an HTTP query string. With CanonicalJSONDigest, the same pairs are serialized as canonical
+// JSON instead, and delimiter and connector are not used. Values containing the delimiter or
+// the connector make query digests ambiguous, so EscapedQueryDigest and LengthPrefixedDigest
+// are safe modes producing distinct digests for distinct pairs.
+//
+// Signer and Verifier are used for asymmetric signing methods like RSA. If Signer is given,
+// the checksum is signed by it before being encoded. If Verifier is given, Verify decodes
+// signatures using the encoding, which must implement Decoding, and verifies them with it.
+//
+// TimestampKey and NonceKey protect Verify from replays. If TimestampKey is given, the value
+// of that key must be a timestamp in TimestampFormat within Tolerance of the time returned by
+// Clock. Tolerance defaults to 5 minutes and Clock defaults to time.Now. If NonceKey is given,
+// the value of that key is recorded in NonceStore once the signature is verified, and a
+// message with a recorded nonce is rejected. NonceStore defaults to an in-memory store
+// holding up to DefaultNonceCapacity nonces.
+//
+// SignInject injects timestamps and nonces under TimestampKey and NonceKey. TimestampFormat
+// is the format of timestamps, UnixSeconds by default, which Verify expects as well. Nonces
+// have NonceLength characters, DefaultNonceLength by default, from NonceAlphabet,
+// DefaultNonceAlphabet by default, which must have up to 256 distinct characters. They're read
+// from Rand, which defaults to crypto/rand.Reader.
+//
+// KeyRing holds keys being rotated. Each key is applied by KeySuffix, which returns the suffix
+// appended to the digest with the secret, and KeyedHasher, which returns a hash keyed by the
+// secret like HMAC. They replace SuffixGenerator and Hasher. If KeyIDKey is given and data has
+// a value of that key, the key with that ID is used. Otherwise the active key signs, and all
+// the valid keys are tried to verify.
+//
+// KeyResolver returns the secret from the data being signed, so one *Qsign signs and verifies
+// for many tenants. The secret is applied by KeySuffix and KeyedHasher as well, and KeyRing is
+// not used. ContextKeyResolver is like it, but receives the context, and overrides it if given.
 type Options struct {
-	PrefixGenerator Generator
-	SuffixGenerator Generator
-	Encoder         Encoder
-	Filter          Filter
-	Hasher          Hasher
+	PrefixGenerator        Generator
+	SuffixGenerator        Generator
+	ContextPrefixGenerator ContextGenerator
+	ContextSuffixGenerator ContextGenerator
+	PairsPrefixGenerator   PairsGenerator
+	PairsSuffixGenerator   PairsGenerator
+	Delimiter              string
+	Connector              string
+	Encoder                Encoder
+	Filter                 Filter
+	Hasher                 Hasher
+	StrictKeys             bool
+	DigestMode             DigestMode
+	Signer                 Signer
+	Verifier               Verifier
+	TimestampKey           string
+	NonceKey               string
+	Tolerance              time.Duration
+	NonceStore             NonceStore
+	Clock                  func() time.Time
+	TimestampFormat        TimestampFormat
+	NonceLength            int
+	NonceAlphabet          string
+	Rand                   io.Reader
+	KeyRing                *KeyRing
+	KeyIDKey               string
+	KeySuffix              func(secret string) string
+	KeyedHasher            func(secret []byte) hash.Hash
+	KeyResolver            KeyResolver
+	ContextKeyResolver     ContextKeyResolver
 }
 
 // NewQsign returns a new *Qsign computing signature.
@@ -55,39 +156,338 @@ func NewQsign(options Options) *Qsign {
 		encoder = defaultEncoder
 	}
 
+	tolerance := options.Tolerance
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+
+	clock := options.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+
+	nonceStore := options.NonceStore
+	if nonceStore == nil && len(options.NonceKey) > 0 {
+		store := NewMemoryNonceStore(DefaultNonceCapacity)
+		store.now = clock
+		nonceStore = store
+	}
+
+	nonceLength := options.NonceLength
+	if nonceLength == 0 {
+		nonceLength = DefaultNonceLength
+	}
+
+	nonceAlphabet := options.NonceAlphabet
+	if len(nonceAlphabet) == 0 {
+		nonceAlphabet = DefaultNonceAlphabet
+	}
+
+	random := options.Rand
+	if random == nil {
+		random = rand.Reader
+	}
+
+	prefixGenerator := options.PairsPrefixGenerator
+	if prefixGenerator == nil {
+		prefixGenerator = pairsGenerator(options.PrefixGenerator, options.ContextPrefixGenerator)
+	}
+
+	suffixGenerator := options.PairsSuffixGenerator
+	if suffixGenerator == nil {
+		suffixGenerator = pairsGenerator(options.SuffixGenerator, options.ContextSuffixGenerator)
+	}
+
+	delimiter := options.Delimiter
+	if len(delimiter) == 0 {
+		delimiter = "&"
+	}
+
+	connector := options.Connector
+	if len(connector) == 0 {
+		connector = "="
+	}
+
+	keyResolver := options.ContextKeyResolver
+	if keyResolver == nil && options.KeyResolver != nil {
+		resolve := options.KeyResolver
+		keyResolver = func(_ context.Context, pairs []Pair) (string, error) {
+			return resolve(pairs)
+		}
+	}
+
 	q := &Qsign{
-		prefixGenerator: options.PrefixGenerator,
-		suffixGenerator: options.SuffixGenerator,
+		prefixGenerator: prefixGenerator,
+		suffixGenerator: suffixGenerator,
 		encoder:         encoder,
 		filter:          filter,
 		hasher:          hasher,
-		delimiter:       "&",
-		connector:       "=",
+		delimiter:       delimiter,
+		connector:       connector,
+		strictKeys:      options.StrictKeys,
+		mode:            options.DigestMode,
+		signer:          options.Signer,
+		verifier:        options.Verifier,
+		timestampKey:    options.TimestampKey,
+		nonceKey:        options.NonceKey,
+		tolerance:       tolerance,
+		nonceStore:      nonceStore,
+		clock:           clock,
+		timestampFormat: options.TimestampFormat,
+		nonceLength:     nonceLength,
+		nonceAlphabet:   nonceAlphabet,
+		rand:            random,
+		keyRing:         options.KeyRing,
+		keyIDKey:        options.KeyIDKey,
+		keySuffix:       options.KeySuffix,
+		keyedHasher:     options.KeyedHasher,
+		keyResolver:     keyResolver,
 	}
 
 	return q
 }
 
 // Sign returns signature bytes for interface v. It calculate the digest of input struct first. And
-// then gets checksum of the digest using hasher. Finally encodes the checksum and returns.
+// then gets checksum of the digest using hasher. If there is a signer, the checksum is signed by it.
+// Finally encodes the result and returns.
+//
+// With a KeyRing, v is signed with the key named by the value of KeyIDKey if there is one,
+// otherwise with the active key.
 func (q *Qsign) Sign(v interface{}) ([]byte, error) {
-	digest, err := q.Digest(v)
+	return q.signFields(context.Background(), v, nil)
+}
+
+// SignContext is like Sign, but generators and key resolvers receive ctx.
+func (q *Qsign) SignContext(ctx context.Context, v interface{}) ([]byte, error) {
+	return q.signFields(ctx, v, nil)
+}
+
+// signFields signs interface v with injected fields.
+func (q *Qsign) signFields(ctx context.Context, v interface{}, injected []*field) ([]byte, error) {
+	fields, err := q.fields(v, injected)
 	if err != nil {
 		return nil, err
 	}
 
-	h := q.hasher()
+	kq, err := q.keyFor(ctx, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	sum, err := kq.sum(ctx, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return kq.sign(sum)
+}
+
+// SignBytes returns signature bytes for raw data, like an HTTP request body. Data is wrapped
+// by the prefix and suffix generators, then goes through the same hasher and encoder as Sign.
+func (q *Qsign) SignBytes(data []byte) ([]byte, error) {
+	return q.SignReaderContext(context.Background(), bytes.NewReader(data))
+}
+
+// SignBytesContext is like SignBytes, but generators and key resolvers receive ctx.
+func (q *Qsign) SignBytesContext(ctx context.Context, data []byte) ([]byte, error) {
+	return q.SignReaderContext(ctx, bytes.NewReader(data))
+}
+
+// SignReader is like SignBytes but reads data from r. Data is streamed into the hasher, so
+// large payloads are never loaded into memory.
+func (q *Qsign) SignReader(r io.Reader) ([]byte, error) {
+	return q.SignReaderContext(context.Background(), r)
+}
+
+// SignReaderContext is like SignReader, but generators and key resolvers receive ctx.
+func (q *Qsign) SignReaderContext(ctx context.Context, r io.Reader) ([]byte, error) {
+	kq, err := q.keyFor(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sum, err := kq.sumReader(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return kq.sign(sum)
+}
+
+// Verify checks signature of interface v. If there is a verifier, signature is decoded by the
+// encoder, then verified against the checksum of the digest. Otherwise v is signed again and
+// compared with signature in constant time.
+//
+// If TimestampKey or NonceKey is given, v is checked against replays as well, after its
+// signature is verified.
+func (q *Qsign) Verify(v interface{}, signature []byte) error {
+	_, err := q.verifyKey(context.Background(), v, signature)
+	return err
+}
+
+// VerifyContext is like Verify, but generators and key resolvers receive ctx.
+func (q *Qsign) VerifyContext(ctx context.Context, v interface{}, signature []byte) error {
+	_, err := q.verifyKey(ctx, v, signature)
+	return err
+}
+
+// VerifyKey is like Verify, but returns the ID of the key which signature is verified with.
+// With a KeyRing, signature is verified with the key named by the value of KeyIDKey if there
+// is one, otherwise with all the valid keys. Without a KeyRing, the key ID is always empty.
+func (q *Qsign) VerifyKey(v interface{}, signature []byte) (string, error) {
+	return q.verifyKey(context.Background(), v, signature)
+}
+
+// verifyKey verifies signature of interface v, and returns the ID of the key verifying it.
+func (q *Qsign) verifyKey(ctx context.Context, v interface{}, signature []byte) (string, error) {
+	fields, err := q.fields(v, nil)
+	if err != nil {
+		return "", err
+	}
+
+	keyID, err := q.verifyKeys(ctx, fields, signature, func(kq *Qsign) ([]byte, error) {
+		return kq.sum(ctx, fields)
+	})
+	if err != nil {
+		return keyID, err
+	}
+
+	return keyID, q.checkReplay(fields)
+}
+
+// VerifyBytes is like Verify but checks signature of raw data, signed by SignBytes.
+func (q *Qsign) VerifyBytes(data []byte, signature []byte) error {
+	return q.VerifyReaderContext(context.Background(), bytes.NewReader(data), signature)
+}
+
+// VerifyBytesContext is like VerifyBytes, but generators and key resolvers receive ctx.
+func (q *Qsign) VerifyBytesContext(ctx context.Context, data []byte, signature []byte) error {
+	return q.VerifyReaderContext(ctx, bytes.NewReader(data), signature)
+}
+
+// VerifyReader is like VerifyBytes but reads data from r. With a KeyRing, data is loaded into
+// memory to be verified with each valid key.
+func (q *Qsign) VerifyReader(r io.Reader, signature []byte) error {
+	return q.VerifyReaderContext(context.Background(), r, signature)
+}
+
+// VerifyReaderContext is like VerifyReader, but generators and key resolvers receive ctx.
+func (q *Qsign) VerifyReaderContext(ctx context.Context, r io.Reader, signature []byte) error {
+	if q.keyRing != nil || q.keyResolver != nil {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.verifyKeys(ctx, nil, signature, func(kq *Qsign) ([]byte, error) {
+			return kq.sumReader(ctx, bytes.NewReader(data))
+		})
+		return err
+	}
+
+	sum, err := q.sumReader(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	return q.verify(sum, signature)
+}
+
+// sum returns the checksum of the digest of fields.
+func (q *Qsign) sum(ctx context.Context, fields []*field) ([]byte, error) {
+	digest, err := q.digestFields(ctx, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher := q.hasher
+	if q.selectHasher != nil {
+		if hasher, err = q.selectHasher(fields); err != nil {
+			return nil, err
+		}
+	}
+
+	h := hasher()
 	h.Write(digest)
 
+	return h.Sum(nil), nil
+}
+
+// sumReader returns the checksum of data read from r, wrapped by the prefix and suffix.
+func (q *Qsign) sumReader(ctx context.Context, r io.Reader) ([]byte, error) {
+	h := q.hasher()
+
+	if q.prefixGenerator != nil {
+		prefix, err := q.prefixGenerator(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		io.WriteString(h, prefix)
+	}
+
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+
+	if q.suffixGenerator != nil {
+		suffix, err := q.suffixGenerator(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		io.WriteString(h, suffix)
+	}
+
+	return h.Sum(nil), nil
+}
+
+// sign signs checksum sum with the signer if there is one, and encodes the result.
+func (q *Qsign) sign(sum []byte) ([]byte, error) {
+	if q.signer != nil {
+		var err error
+		if sum, err = q.signer.Sign(sum); err != nil {
+			return nil, err
+		}
+	}
+
 	e := q.encoder()
-	dst := make([]byte, e.EncodedLen(h.Size()))
-	e.Encode(dst, h.Sum(nil))
+	dst := make([]byte, e.EncodedLen(len(sum)))
+	e.Encode(dst, sum)
 
 	return dst, nil
 }
 
+// verify checks signature against checksum sum.
+func (q *Qsign) verify(sum, signature []byte) error {
+	if q.verifier == nil {
+		expect, err := q.sign(sum)
+		if err != nil {
+			return err
+		}
+
+		if subtle.ConstantTimeCompare(expect, signature) != 1 {
+			return ErrSignatureMismatch
+		}
+		return nil
+	}
+
+	d, ok := q.encoder().(Decoding)
+	if !ok {
+		return configError("Encoder", "encoding can't decode signatures")
+	}
+
+	raw := make([]byte, d.DecodedLen(len(signature)))
+	n, err := d.Decode(raw, signature)
+	if err != nil {
+		return ErrSignatureMismatch
+	}
+
+	return q.verifier.Verify(sum, raw[:n])
+}
+
 // Digest generates digest bytes for interface v. By default, it parses struct v, gets all the
-// keys and values, and connects them like an HTTP query string.
+// keys and values, and connects them like an HTTP query string. With CanonicalJSONDigest mode,
+// they are serialized as canonical JSON. EscapedQueryDigest and LengthPrefixedDigest modes
+// escape or length-prefix them, so distinct pairs never produce the same digest.
 //
 // Key's value is struct field name if there is no tags like "qsign", "json", "yaml" or "xml". If
 // any key has a tag mentioned before, it will get value from the tag for that key. Tag name "qsign"
@@ -95,48 +495,228 @@ func (q *Qsign) Sign(v interface{}) ([]byte, error) {
 //
 // All the values expect for Array, Slice and Struct type will be parsed to string. There is an
 // exception here, if the struct has a String method (`func String() string`), it will be parsed.
+//
+// An error is returned if the struct embeds itself, directly or through other embedded structs,
+// or if pointers held by embedded interfaces form a cycle.
 func (q *Qsign) Digest(v interface{}) ([]byte, error) {
+	return q.DigestContext(context.Background(), v)
+}
+
+// DigestContext is like Digest, but generators and key resolvers receive ctx. Errors returned
+// by them are returned.
+func (q *Qsign) DigestContext(ctx context.Context, v interface{}) ([]byte, error) {
+	fields, err := q.fields(v, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	kq, err := q.keyFor(ctx, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return kq.digestFields(ctx, fields)
+}
+
+// fields returns the filtered fields of interface v, with fields of the same keys replaced by
+// injected ones.
+func (q *Qsign) fields(v interface{}, injected []*field) ([]*field, error) {
+	vs, collisions, err := getStructValues(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.strictKeys && len(collisions) > 0 {
+		return nil, collisionError(collisions)
+	}
+
+	filtered := []*field{}
+	for _, f := range inject(vs, injected) {
+		if q.filter(f.name, f.value) {
+			filtered = append(filtered, f)
+		}
+	}
+
+	return filtered, nil
+}
+
+// digestFields generates digest bytes for fields.
+func (q *Qsign) digestFields(ctx context.Context, fields []*field) ([]byte, error) {
 	buf := new(bytes.Buffer)
 
 	if q.prefixGenerator != nil {
-		if _, err := buf.WriteString(q.prefixGenerator()); err != nil {
-			return buf.Bytes(), err
+		prefix, err := q.prefixGenerator(ctx, pairsOf(fields))
+		if err != nil {
+			return nil, err
 		}
+		buf.WriteString(prefix)
 	}
 
-	vs := getStructValues(v)
+	switch q.mode {
+	case CanonicalJSONDigest:
+		if err := writeCanonicalJSON(buf, fields); err != nil {
+			return nil, err
+		}
+	case EscapedQueryDigest:
+		buf.WriteString(q.connectEscaped(fields))
+	case LengthPrefixedDigest:
+		writeLengthPrefixed(buf, fields)
+	default:
+		buf.WriteString(q.connect(fields))
+	}
 
-	pairs := []string{}
-	for _, f := range vs {
-		if !q.filter(f.name, f.value) {
-			continue
+	if q.suffixGenerator != nil {
+		suffix, err := q.suffixGenerator(ctx, pairsOf(fields))
+		if err != nil {
+			return nil, err
 		}
+		buf.WriteString(suffix)
+	}
 
+	return buf.Bytes(), nil
+}
+
+// connect connects key-value pairs of fields like an HTTP query string, using the connector
+// and delimiter of q.
+func (q *Qsign) connect(fields []*field) string {
+	pairs := make([]string, len(fields))
+	for i, f := range fields {
 		var buf strings.Builder
 		buf.WriteString(f.name)
 		buf.WriteString(q.connector)
 		buf.WriteString(f.value)
 
-		pairs = append(pairs, buf.String())
+		pairs[i] = buf.String()
 	}
-	connected := strings.Join(pairs, q.delimiter)
-	buf.WriteString(connected)
+	return strings.Join(pairs, q.delimiter)
+}
 
-	if q.suffixGenerator != nil {
-		if _, err := buf.WriteString(q.suffixGenerator()); err != nil {
-			return buf.Bytes(), err
+// connectEscaped is like connect, but escapes bytes of the connector and the delimiter of q in
+// keys and values.
+func (q *Qsign) connectEscaped(fields []*field) string {
+	special := "%" + q.delimiter + q.connector
+	escaped := make([]*field, len(fields))
+	for i, f := range fields {
+		escaped[i] = &field{name: escape(f.name, special), value: escape(f.value, special)}
+	}
+	return q.connect(escaped)
+}
+
+// escape replaces bytes of s in special with "%" and their uppercase hex.
+func escape(s, special string) string {
+	if !strings.ContainsAny(s, special) {
+		return s
+	}
+
+	const hextable = "0123456789ABCDEF"
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if strings.IndexByte(special, c) < 0 {
+			buf.WriteByte(c)
+			continue
 		}
+		buf.WriteByte('%')
+		buf.WriteByte(hextable[c>>4])
+		buf.WriteByte(hextable[c&0x0f])
 	}
+	return buf.String()
+}
 
-	return buf.Bytes(), nil
+// writeLengthPrefixed writes keys and values of fields to buf, each prefixed by its length.
+func writeLengthPrefixed(buf *bytes.Buffer, fields []*field) {
+	for _, f := range fields {
+		for _, s := range []string{f.name, f.value} {
+			buf.WriteString(strconv.Itoa(len(s)))
+			buf.WriteByte(':')
+			buf.WriteString(s)
+		}
+	}
+}
+
+// collisionError returns a *CollisionError listing colliding keys and paths of the fields
+// producing them.
+func collisionError(collisions []*collision) error {
+	err := &CollisionError{Collisions: make([]Collision, len(collisions))}
+	for i, c := range collisions {
+		err.Collisions[i] = Collision{Key: c.name, Paths: c.paths}
+	}
+	return err
+}
+
+// clone returns a shallow copy of q.
+func (q *Qsign) clone() *Qsign {
+	c := *q
+	return &c
+}
+
+// WithDelimiter returns a copy of q using delimiter s.
+func (q *Qsign) WithDelimiter(s string) *Qsign {
+	c := q.clone()
+	c.delimiter = s
+	return c
+}
+
+// WithConnector returns a copy of q using connector s.
+func (q *Qsign) WithConnector(s string) *Qsign {
+	c := q.clone()
+	c.connector = s
+	return c
+}
+
+// WithFilter returns a copy of q using filter f. A nil f means the default filter, like in
+// Options.
+func (q *Qsign) WithFilter(f Filter) *Qsign {
+	if f == nil {
+		f = defaultFilter
+	}
+	c := q.clone()
+	c.filter = f
+	return c
+}
+
+// WithEncoder returns a copy of q using encoder e. A nil e means the default hex encoder, like
+// in Options.
+func (q *Qsign) WithEncoder(e Encoder) *Qsign {
+	if e == nil {
+		e = defaultEncoder
+	}
+	c := q.clone()
+	c.encoder = e
+	return c
+}
+
+// WithHasher returns a copy of q using hasher h. It replaces the hasher chosen by the sign type
+// of presets like NewWechatPayV2 as well. A nil h means the default MD5 hasher, like in Options.
+func (q *Qsign) WithHasher(h Hasher) *Qsign {
+	if h == nil {
+		h = defaultHasher
+	}
+	c := q.clone()
+	c.hasher = h
+	c.selectHasher = nil
+	return c
+}
+
+// WithDigestMode returns a copy of q using digest mode m.
+func (q *Qsign) WithDigestMode(m DigestMode) *Qsign {
+	c := q.clone()
+	c.mode = m
+	return c
 }
 
 // SetDelimiter changes the default delimiter.
+//
+// Deprecated: SetDelimiter races with signing in other goroutines. Use WithDelimiter or
+// Options.Delimiter instead.
 func (q *Qsign) SetDelimiter(s string) {
 	q.delimiter = s
 }
 
 // SetConnector changes the default connector.
+//
+// Deprecated: SetConnector races with signing in other goroutines. Use WithConnector or
+// Options.Connector instead.
 func (q *Qsign) SetConnector(s string) {
 	q.connector = s
 }
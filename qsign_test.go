@@ -1,6 +1,19 @@
 package qsign
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -42,6 +55,94 @@ func TestQsignSetConnector(t *testing.T) {
 	}
 }
 
+func TestQsignOptionsSeparators(t *testing.T) {
+	q := NewQsign(Options{Delimiter: ",", Connector: ":"})
+	d, err := q.Digest(struct {
+		A string
+		B string
+	}{"1", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != "A:1,B:2" {
+		t.Errorf("expect digest is A:1,B:2, actual is %s", d)
+	}
+}
+
+func TestQsignWith(t *testing.T) {
+	v := struct {
+		A string
+		B string
+	}{"1", ""}
+
+	q := NewQsign(Options{})
+	cases := []struct {
+		q      *Qsign
+		expect string
+	}{
+		{q, "A=1"},
+		{q.WithDelimiter(","), "A=1"},
+		{q.WithConnector(":"), "A:1"},
+		{q.WithFilter(func(key, value string) bool { return true }).WithDelimiter(","), "A=1,B="},
+		{q.WithDigestMode(CanonicalJSONDigest), `{"A":"1"}`},
+	}
+
+	for _, c := range cases {
+		d, err := c.q.Digest(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(d) != c.expect {
+			t.Errorf("expect digest is %s, actual is %s", c.expect, d)
+		}
+	}
+
+	if q.delimiter != "&" || q.connector != "=" || q.mode != QueryDigest {
+		t.Error("expect q is not changed by With methods")
+	}
+
+	hq := q.WithHasher(sha256.New).WithEncoder(func() Encoding { return base64.StdEncoding })
+	s, _ := hq.Sign(v)
+	if expect := "8dMW0zBEDepG2WrUP2Vi/5QRwbhHAHlNzVhPGBRqGPY="; string(s) != expect {
+		t.Errorf("expect signature is %s, actual is %s", expect, s)
+	}
+}
+
+func TestQsignConcurrentSign(t *testing.T) {
+	q := NewQsign(Options{})
+	v := struct {
+		A string
+		B string
+	}{"1", "2"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			dq := q.WithDelimiter(strconv.Itoa(i))
+			expect := "A=1" + strconv.Itoa(i) + "B=2"
+			for j := 0; j < 100; j++ {
+				d, err := dq.Digest(v)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if string(d) != expect {
+					t.Errorf("expect digest is %s, actual is %s", expect, d)
+					return
+				}
+				if _, err := q.Sign(v); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
 func TestQsignDigest(t *testing.T) {
 	q := NewQsign(Options{})
 
@@ -96,6 +197,77 @@ func TestQsignDigest(t *testing.T) {
 	}
 }
 
+func TestQsignSafeDigest(t *testing.T) {
+	pkg := weixinPayPackage{
+		weixinPayApp: &weixinPayApp{AppID: "wx6cfc34d48f33effe"},
+		TimeStamp:    1503117550,
+		Package:      "prepay_id=wx20170819124333185b7b54140976921757",
+	}
+
+	// both connect to "a=1&b=2" in QueryDigest mode
+	joined := struct {
+		A string `qsign:"a"`
+	}{"1&b=2"}
+	split := struct {
+		A string `qsign:"a"`
+		B string `qsign:"b"`
+	}{"1", "2"}
+
+	cases := []struct {
+		mode   DigestMode
+		expect []string
+	}{
+		{QueryDigest, []string{
+			"appId=wx6cfc34d48f33effe&package=prepay_id=wx20170819124333185b7b54140976921757&timeStamp=1503117550",
+			"a=1&b=2",
+			"a=1&b=2",
+		}},
+		{EscapedQueryDigest, []string{
+			"appId=wx6cfc34d48f33effe&package=prepay_id%3Dwx20170819124333185b7b54140976921757&timeStamp=1503117550",
+			"a=1%26b%3D2",
+			"a=1&b=2",
+		}},
+		{LengthPrefixedDigest, []string{
+			"5:appId18:wx6cfc34d48f33effe7:package46:prepay_id=wx20170819124333185b7b541409769217579:timeStamp10:1503117550",
+			"1:a5:1&b=2",
+			"1:a1:11:b1:2",
+		}},
+	}
+
+	for _, c := range cases {
+		q := NewQsign(Options{DigestMode: c.mode})
+		for i, v := range []interface{}{pkg, joined, split} {
+			d, err := q.Digest(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(d) != c.expect[i] {
+				t.Errorf("expect digest is %s, actual is %s", c.expect[i], d)
+			}
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	cases := []struct {
+		input   string
+		special string
+		expect  string
+	}{
+		{"abc", "%&=", "abc"},
+		{"a=b&c", "%&=", "a%3Db%26c"},
+		{"100%", "%&=", "100%25"},
+		{"a,b:c", "%,:", "a%2Cb%3Ac"},
+		{"a\nb", "%\n", "a%0Ab"},
+	}
+
+	for _, c := range cases {
+		if actual := escape(c.input, c.special); actual != c.expect {
+			t.Errorf("expect %q is escaped to %q, actual is %q", c.input, c.expect, actual)
+		}
+	}
+}
+
 func TestQsignSign(t *testing.T) {
 	q := NewQsign(Options{})
 
@@ -210,3 +382,547 @@ func TestQsignPrefixSuffixGenerators(t *testing.T) {
 		}
 	}
 }
+
+func TestQsignDigestRecursiveEmbedding(t *testing.T) {
+	type node struct {
+		*node
+		ID int
+	}
+
+	q := NewQsign(Options{})
+	if _, err := q.Digest(node{ID: 1}); err == nil {
+		t.Errorf("expect recursive embedding returns an error")
+	}
+	if _, err := q.Sign(&node{ID: 1}); err == nil {
+		t.Errorf("expect recursive embedding returns an error")
+	}
+}
+
+func TestQsignStrictKeys(t *testing.T) {
+	input := struct {
+		*weixinPayApp
+		AppID    string `qsign:"appId"`
+		NonceStr string `qsign:"nonce_str"`
+	}{
+		weixinPayApp: &weixinPayApp{AppID: "inner"},
+		AppID:        "outer",
+		NonceStr:     "ibuaiVcKdpRxkhJA",
+	}
+
+	q := NewQsign(Options{})
+	d, err := q.Digest(input)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	if expect := "appId=outer&nonce_str=ibuaiVcKdpRxkhJA"; string(d) != expect {
+		t.Errorf("expect digest is %s, actual is %s", expect, string(d))
+	}
+
+	q = NewQsign(Options{StrictKeys: true})
+	_, err = q.Digest(input)
+	if err == nil {
+		t.Fatalf("expect duplicate keys return an error")
+	}
+	if expect := "qsign: duplicate keys: appId (AppID, weixinPayApp.AppID)"; err.Error() != expect {
+		t.Errorf("expect error is %s, actual is %s", expect, err)
+	}
+	var ce *CollisionError
+	if !errors.As(err, &ce) || !reflect.DeepEqual(ce.Collisions, []Collision{{Key: "appId", Paths: []string{"AppID", "weixinPayApp.AppID"}}}) {
+		t.Errorf("expect a *CollisionError of appId, actual is %#v", err)
+	}
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Path != "AppID" {
+		t.Errorf("expect a *FieldError of AppID, actual is %#v", err)
+	}
+
+	if _, err = q.Digest(weixinPayPackage{weixinPayApp: &weixinPayApp{}}); err != nil {
+		t.Errorf("expect no error, actual %v", err)
+	}
+}
+
+func TestQsignCanonicalJSONDigestNil(t *testing.T) {
+	q := NewQsign(Options{
+		DigestMode: CanonicalJSONDigest,
+		Filter: func(key, value string) bool {
+			return true
+		},
+	})
+
+	type Point struct{ X int }
+
+	n := 7
+	cases := []struct {
+		input  interface{}
+		expect string
+	}{
+		{
+			input: struct {
+				Count *int  `qsign:"count"`
+				Paid  *bool `qsign:"paid"`
+				Name  *string
+			}{},
+			expect: `{"Name":null,"count":null,"paid":null}`,
+		},
+		{
+			input: struct {
+				Count *int `qsign:"count"`
+			}{Count: &n},
+			expect: `{"count":7}`,
+		},
+		{
+			input: struct {
+				I interface{} `qsign:"i"`
+				P *int        `qsign:"p"`
+			}{},
+			expect: `{"i":null,"p":null}`,
+		},
+		{
+			input:  map[string]interface{}{"a": nil, "b": (*int)(nil), "c": ""},
+			expect: `{"a":null,"b":null,"c":""}`,
+		},
+		{
+			// like encoding/json, fields promoted through a nil pointer are omitted
+			input: struct {
+				*Point
+				Y int
+			}{Y: 1},
+			expect: `{"Y":1}`,
+		},
+		{
+			input: struct {
+				*Point
+				Y int
+			}{Point: &Point{}, Y: 1},
+			expect: `{"X":0,"Y":1}`,
+		},
+	}
+
+	for _, c := range cases {
+		d, err := q.Digest(c.input)
+		if err != nil {
+			t.Errorf("expect no error, actual %v", err)
+		}
+		if string(d) != c.expect {
+			t.Errorf("expect digest is %s, actual is %s", c.expect, d)
+		}
+	}
+}
+
+func TestQsignCanonicalJSONDigest(t *testing.T) {
+	q := NewQsign(Options{
+		DigestMode: CanonicalJSONDigest,
+		SuffixGenerator: func() string {
+			return "&key=123456"
+		},
+	})
+
+	cases := []struct {
+		input  interface{}
+		expect string
+	}{
+		{
+			input: struct {
+			}{},
+			expect: "{}&key=123456",
+		},
+		{
+			input: struct {
+				AppID     string  `qsign:"appId"`
+				TimeStamp int64   `qsign:"timeStamp"`
+				Amount    float32 `qsign:"amount"`
+				Paid      bool    `qsign:"paid"`
+				Body      string  `qsign:"body"`
+				NonceStr  string  `qsign:"-"`
+				Empty     string  `qsign:"empty"`
+			}{
+				AppID:     "wx6cfc34d48f33effe",
+				TimeStamp: 1503117550,
+				Amount:    0.1,
+				Paid:      true,
+				Body:      "say \"hi\"\n",
+				NonceStr:  "9446",
+			},
+			expect: `{"amount":0.1,"appId":"wx6cfc34d48f33effe","body":"say \"hi\"\n","paid":true,"timeStamp":1503117550}&key=123456`,
+		},
+	}
+
+	for _, c := range cases {
+		d, err := q.Digest(c.input)
+		if err != nil {
+			t.Errorf("expect no error, actual %v", err)
+		}
+		actual := string(d)
+		if actual != c.expect {
+			t.Errorf("expect digest is %s, actual is %s", c.expect, actual)
+		}
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestQsignSignBytes(t *testing.T) {
+	cases := []struct {
+		input  []byte
+		prefix Generator
+		suffix Generator
+		expect string
+	}{
+		{
+			input:  []byte{},
+			expect: "d41d8cd98f00b204e9800998ecf8427e",
+		},
+		{
+			input: []byte("appid=wxd930ea5d5a258f4f&body=test&device_info=1000&mch_id=10000100&nonce_str=ibuaiVcKdpRxkhJA"),
+			suffix: func() string {
+				return "&key=192006250b4c09247ec02edce69f6a2d"
+			},
+			expect: "9a0a8659f005d6984697e2ca0a9cf3b7",
+		},
+		{
+			input: []byte("device_info=1000&mch_id=10000100&nonce_str=ibuaiVcKdpRxkhJA"),
+			prefix: func() string {
+				return "appid=wxd930ea5d5a258f4f&body=test&"
+			},
+			suffix: func() string {
+				return "&key=192006250b4c09247ec02edce69f6a2d"
+			},
+			expect: "9a0a8659f005d6984697e2ca0a9cf3b7",
+		},
+	}
+
+	for _, c := range cases {
+		q := NewQsign(Options{
+			PrefixGenerator: c.prefix,
+			SuffixGenerator: c.suffix,
+		})
+
+		d, err := q.SignBytes(c.input)
+		if err != nil {
+			t.Errorf("expect no error, actual %v", err)
+		}
+		if actual := string(d); actual != c.expect {
+			t.Errorf("expect sign is %s, actual is %s", c.expect, actual)
+		}
+
+		d, err = q.SignReader(bytes.NewReader(c.input))
+		if err != nil {
+			t.Errorf("expect no error, actual %v", err)
+		}
+		if actual := string(d); actual != c.expect {
+			t.Errorf("expect sign is %s, actual is %s", c.expect, actual)
+		}
+	}
+}
+
+func TestQsignSignReader(t *testing.T) {
+	q := NewQsign(Options{
+		Hasher: sha256.New,
+	})
+
+	// 64 MiB of zeros, streamed without being held in memory
+	const size = 64 << 20
+	d, err := q.SignReader(io.LimitReader(zeroReader{}, size))
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+
+	h := sha256.New()
+	io.CopyN(h, zeroReader{}, size)
+	if expect := hex.EncodeToString(h.Sum(nil)); string(d) != expect {
+		t.Errorf("expect sign is %s, actual is %s", expect, string(d))
+	}
+
+	if _, err := q.SignReader(errReader{}); err == nil {
+		t.Errorf("expect read error is returned")
+	}
+}
+
+func TestQsignVerify(t *testing.T) {
+	q := NewQsign(Options{
+		SuffixGenerator: func() string {
+			return "&key=192006250b4c09247ec02edce69f6a2d"
+		},
+	})
+
+	data := map[string]interface{}{
+		"appid":       "wxd930ea5d5a258f4f",
+		"mch_id":      10000100,
+		"device_info": "1000",
+		"body":        "test",
+		"nonce_str":   "ibuaiVcKdpRxkhJA",
+		"ignored":     []string{"slices are not supported"},
+	}
+
+	cases := []struct {
+		signature string
+		expect    error
+	}{
+		{"9a0a8659f005d6984697e2ca0a9cf3b7", nil},
+		{"9A0A8659F005D6984697E2CA0A9CF3B7", ErrSignatureMismatch},
+		{"9a0a8659f005d6984697e2ca0a9cf3b", ErrSignatureMismatch},
+		{"", ErrSignatureMismatch},
+	}
+
+	for _, c := range cases {
+		if err := q.Verify(data, []byte(c.signature)); err != c.expect {
+			t.Errorf("expect signature %s verified with %v, actual %v", c.signature, c.expect, err)
+		}
+	}
+
+	digest := "appid=wxd930ea5d5a258f4f&body=test&device_info=1000&mch_id=10000100&nonce_str=ibuaiVcKdpRxkhJA"
+	if err := q.VerifyBytes([]byte(digest), []byte(cases[0].signature)); err != nil {
+		t.Errorf("expect raw data is verified, actual %v", err)
+	}
+	if err := q.VerifyReader(errReader{}, []byte(cases[0].signature)); err == nil {
+		t.Errorf("expect read error is returned")
+	}
+}
+
+func TestQsignVerifyMapWithSignature(t *testing.T) {
+	q := NewQsign(Options{
+		SuffixGenerator: func() string {
+			return "&key=192006250b4c09247ec02edce69f6a2d"
+		},
+	})
+
+	params := map[string]string{
+		"appid":     "wxd930ea5d5a258f4f",
+		"mch_id":    "10000100",
+		"nonce_str": "ibuaiVcKdpRxkhJA",
+	}
+	signature, err := q.Sign(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params["sign"] = string(signature)
+
+	if err := q.Verify(params, signature); err != ErrSignatureMismatch {
+		t.Errorf("expect signature key is signed and mismatches, actual %v", err)
+	}
+
+	q = q.WithFilter(func(key, value string) bool { return key != "sign" })
+	if err := q.Verify(params, []byte(params["sign"])); err != nil {
+		t.Errorf("expect signature key is filtered out and verified, actual %v", err)
+	}
+}
+
+func TestQsignVerifyWithVerifier(t *testing.T) {
+	key := testRSAKey(t)
+	data := struct {
+		AppID string `qsign:"appId"`
+	}{"wx6cfc34d48f33effe"}
+
+	signer := NewQsign(Options{
+		Hasher: sha256.New,
+		Signer: NewRSASigner(key, crypto.SHA256),
+	})
+	signature, err := signer.Sign(data)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+
+	verifier := NewQsign(Options{
+		Hasher:   sha256.New,
+		Verifier: NewRSAVerifier(&key.PublicKey, crypto.SHA256),
+	})
+	if err := verifier.Verify(data, signature); err != nil {
+		t.Errorf("expect signature is verified, actual %v", err)
+	}
+	if err := verifier.Verify(data, []byte("not hex")); err != ErrSignatureMismatch {
+		t.Errorf("expect signature mismatch, actual %v", err)
+	}
+
+	verifier = NewQsign(Options{
+		Hasher: sha256.New,
+		Encoder: func() Encoding {
+			return &encodeOnly{}
+		},
+		Verifier: NewRSAVerifier(&key.PublicKey, crypto.SHA256),
+	})
+	if err := verifier.Verify(data, signature); err == nil {
+		t.Errorf("expect encoding without decoding returns an error")
+	}
+}
+
+// encodeOnly is an Encoding which doesn't implement Decoding.
+type encodeOnly struct{}
+
+func (e *encodeOnly) Encode(dst, src []byte) {
+	hex.Encode(dst, src)
+}
+
+func (e *encodeOnly) EncodedLen(n int) int {
+	return hex.EncodedLen(n)
+}
+
+type secretContextKey struct{}
+
+func TestQsignContext(t *testing.T) {
+	errVault := errors.New("vault is sealed")
+	q := NewQsign(Options{
+		ContextPrefixGenerator: func(ctx context.Context) (string, error) {
+			return "", ctx.Err()
+		},
+		ContextSuffixGenerator: func(ctx context.Context) (string, error) {
+			secret, ok := ctx.Value(secretContextKey{}).(string)
+			if !ok {
+				return "", errVault
+			}
+			return "&key=" + secret, nil
+		},
+		SuffixGenerator: func() string {
+			return "&key=overridden"
+		},
+	})
+
+	data := map[string]interface{}{
+		"appid":       "wxd930ea5d5a258f4f",
+		"mch_id":      10000100,
+		"device_info": "1000",
+		"body":        "test",
+		"nonce_str":   "ibuaiVcKdpRxkhJA",
+	}
+	ctx := context.WithValue(context.Background(), secretContextKey{}, "192006250b4c09247ec02edce69f6a2d")
+
+	digest, err := q.DigestContext(ctx, data)
+	expect := "appid=wxd930ea5d5a258f4f&body=test&device_info=1000&mch_id=10000100&nonce_str=ibuaiVcKdpRxkhJA&key=192006250b4c09247ec02edce69f6a2d"
+	if err != nil || string(digest) != expect {
+		t.Errorf("expect digest %s, actual %s, %v", expect, digest, err)
+	}
+
+	signature, err := q.SignContext(ctx, data)
+	if err != nil || string(signature) != "9a0a8659f005d6984697e2ca0a9cf3b7" {
+		t.Errorf("expect signature 9a0a8659f005d6984697e2ca0a9cf3b7, actual %s, %v", signature, err)
+	}
+	if err := q.VerifyContext(ctx, data, signature); err != nil {
+		t.Errorf("expect no error, actual %v", err)
+	}
+
+	if _, err := q.Digest(data); err != errVault {
+		t.Errorf("expect generator error is returned by Digest, actual %v", err)
+	}
+	if _, err := q.Sign(data); err != errVault {
+		t.Errorf("expect generator error is returned by Sign, actual %v", err)
+	}
+	if _, err := q.SignBytes([]byte("raw")); err != errVault {
+		t.Errorf("expect generator error is returned by SignBytes, actual %v", err)
+	}
+	if err := q.Verify(data, signature); err != errVault {
+		t.Errorf("expect generator error is returned by Verify, actual %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := q.SignContext(canceled, data); err != context.Canceled {
+		t.Errorf("expect canceled, actual %v", err)
+	}
+
+	raw := []byte("raw")
+	rawSignature, _ := NewQsign(Options{
+		SuffixGenerator: func() string { return "&key=192006250b4c09247ec02edce69f6a2d" },
+	}).SignBytes(raw)
+	signature, err = q.SignBytesContext(ctx, raw)
+	if err != nil || string(signature) != string(rawSignature) {
+		t.Errorf("expect raw signature %s, actual %s, %v", rawSignature, signature, err)
+	}
+	if signature, err = q.SignReaderContext(ctx, bytes.NewReader(raw)); err != nil || string(signature) != string(rawSignature) {
+		t.Errorf("expect raw signature %s, actual %s, %v", rawSignature, signature, err)
+	}
+	if err := q.VerifyBytesContext(ctx, raw, rawSignature); err != nil {
+		t.Errorf("expect raw data is verified, actual %v", err)
+	}
+	if err := q.VerifyReaderContext(ctx, bytes.NewReader(raw), rawSignature); err != nil {
+		t.Errorf("expect raw data is verified, actual %v", err)
+	}
+	if _, err := q.SignReaderContext(canceled, bytes.NewReader(raw)); err != context.Canceled {
+		t.Errorf("expect canceled, actual %v", err)
+	}
+	if err := q.VerifyBytes(raw, rawSignature); err != errVault {
+		t.Errorf("expect generator error is returned by VerifyBytes, actual %v", err)
+	}
+}
+
+func TestQsignContextKeyResolver(t *testing.T) {
+	q := NewQsign(Options{
+		KeySuffix: func(secret string) string {
+			return "&key=" + secret
+		},
+		KeyResolver: func(pairs []Pair) (string, error) {
+			return "overridden", nil
+		},
+		ContextKeyResolver: func(ctx context.Context, pairs []Pair) (string, error) {
+			return ctx.Value(secretContextKey{}).(string), nil
+		},
+	})
+
+	ctx := context.WithValue(context.Background(), secretContextKey{}, "secret")
+	digest, err := q.DigestContext(ctx, map[string]string{"a": "1"})
+	if expect := "a=1&key=secret"; err != nil || string(digest) != expect {
+		t.Errorf("expect digest %s, actual %s, %v", expect, digest, err)
+	}
+
+	expect, _ := NewQsign(Options{}).SignBytes([]byte("raw&key=secret"))
+	signature, err := q.SignBytesContext(ctx, []byte("raw"))
+	if err != nil || string(signature) != string(expect) {
+		t.Errorf("expect raw signature %s, actual %s, %v", expect, signature, err)
+	}
+	if err := q.VerifyBytesContext(ctx, []byte("raw"), signature); err != nil {
+		t.Errorf("expect raw data is verified, actual %v", err)
+	}
+}
+
+func TestQsignPairsGenerators(t *testing.T) {
+	q := NewQsign(Options{
+		PairsPrefixGenerator: func(ctx context.Context, pairs []Pair) (string, error) {
+			return fmt.Sprintf("%d:", len(pairs)), nil
+		},
+		PairsSuffixGenerator: func(ctx context.Context, pairs []Pair) (string, error) {
+			for _, p := range pairs {
+				if p.Key == "appid" {
+					return "&key=" + strings.ToUpper(p.Value), nil
+				}
+			}
+			return "", errors.New("missing appid")
+		},
+		SuffixGenerator: func() string {
+			return "&key=overridden"
+		},
+	})
+
+	data := map[string]interface{}{
+		"appid":   "wxd930ea5d5a258f4f",
+		"mch_id":  10000100,
+		"ignored": "",
+	}
+
+	digest, err := q.Digest(data)
+	expect := "2:appid=wxd930ea5d5a258f4f&mch_id=10000100&key=WXD930EA5D5A258F4F"
+	if err != nil || string(digest) != expect {
+		t.Errorf("expect digest %s, actual %s, %v", expect, digest, err)
+	}
+
+	signature, _ := q.Sign(data)
+	if err := q.Verify(data, signature); err != nil {
+		t.Errorf("expect no error, actual %v", err)
+	}
+
+	if _, err := q.Digest(map[string]string{"mch_id": "10000100"}); err == nil {
+		t.Errorf("expect generator error is returned, actual nil")
+	}
+	if _, err := q.SignBytes([]byte("raw")); err == nil {
+		t.Errorf("expect generators receive no pairs for raw data, actual nil")
+	}
+}
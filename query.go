@@ -0,0 +1,77 @@
+package qsign
+
+import (
+	"net/url"
+	"sort"
+)
+
+// queryQsign connects query parameters, empty values are kept.
+var queryQsign = NewQsign(Options{
+	Filter: func(key, value string) bool {
+		return true
+	},
+})
+
+// CanonicalQuery returns the canonical query string of values. Keys and values are escaped by
+// RFC 3986, then pairs are sorted by key and value and connected like Digest does, e.g.
+// "Limit=10&Offset=0&Region=ap-guangzhou". Requests signed with a canonical query should use
+// it as the query string, so the server sees the same parameters.
+func CanonicalQuery(values url.Values) string {
+	fields := []*field{}
+	for k, vs := range values {
+		for _, v := range vs {
+			fields = append(fields, &field{
+				name:  escapeRFC3986(k),
+				value: escapeRFC3986(v),
+			})
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].name != fields[j].name {
+			return fields[i].name < fields[j].name
+		}
+		return fields[i].value < fields[j].value
+	})
+
+	return queryQsign.connect(fields)
+}
+
+// escapeRFC3986 escapes s by RFC 3986. Only unreserved characters are kept as they are, all
+// the other bytes are percent-encoded with uppercase hex digits.
+func escapeRFC3986(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if !isUnreserved(s[i]) {
+			n++
+		}
+	}
+	if n == 0 {
+		return s
+	}
+
+	buf := make([]byte, 0, len(s)+2*n)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isUnreserved(c) {
+			buf = append(buf, c)
+			continue
+		}
+		buf = append(buf, '%', hex[c>>4], hex[c&0x0f])
+	}
+	return string(buf)
+}
+
+// isUnreserved checks if c is an unreserved character of RFC 3986.
+func isUnreserved(c byte) bool {
+	switch {
+	case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+		return true
+	case c == '-', c == '_', c == '.', c == '~':
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,42 @@
+package qsign
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestQueryEscapeRFC3986(t *testing.T) {
+	cases := []struct {
+		input  string
+		expect string
+	}{
+		{"", ""},
+		{"AZaz09-_.~", "AZaz09-_.~"},
+		{"a b+c*d", "a%20b%2Bc%2Ad"},
+		{"/?&=%", "%2F%3F%26%3D%25"},
+		{"未命名", "%E6%9C%AA%E5%91%BD%E5%90%8D"},
+	}
+
+	for _, c := range cases {
+		if actual := escapeRFC3986(c.input); actual != c.expect {
+			t.Errorf("expect %q is escaped as %s, actual is %s", c.input, c.expect, actual)
+		}
+	}
+}
+
+func TestQueryCanonicalQuery(t *testing.T) {
+	cases := []struct {
+		input  url.Values
+		expect string
+	}{
+		{nil, ""},
+		{url.Values{"Limit": {"10"}, "Offset": {"0"}}, "Limit=10&Offset=0"},
+		{url.Values{"b": {"2", "1"}, "a": {""}, "a b": {"x/y"}}, "a=&a%20b=x%2Fy&b=1&b=2"},
+	}
+
+	for _, c := range cases {
+		if actual := CanonicalQuery(c.input); actual != c.expect {
+			t.Errorf("expect canonical query is %s, actual is %s", c.expect, actual)
+		}
+	}
+}
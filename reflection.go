@@ -1,6 +1,7 @@
 package qsign
 
 import (
+	"errors"
 	"reflect"
 	"sort"
 	"strconv"
@@ -11,13 +12,36 @@ import (
 type conversion struct {
 	stringable  bool
 	marshalable bool
+	dynamic     bool
 }
 
+// valueKind is the kind of a field's value, which is kept by digest modes preserving types.
+type valueKind int
+
+const (
+	stringKind valueKind = iota
+	numberKind
+	boolKind
+
+	// nullKind is the kind of nil pointers, whose values are empty.
+	nullKind
+)
+
 type field struct {
+	name      string
+	value     string
+	kind      valueKind
+	idx       []int
+	conv      conversion
+	anonymous bool
+	tagged    bool
+	path      string
+}
+
+// collision records a key produced by more than one struct field.
+type collision struct {
 	name  string
-	value string
-	idx   []int
-	conv  conversion
+	paths []string
 }
 
 // stringable interface is used to check if a type has String() function.
@@ -31,40 +55,275 @@ var (
 	typeInfoMap      = make(map[reflect.Type][]*field)
 	typeOfStringable = reflect.TypeOf((*stringable)(nil)).Elem()
 	typeOfMarshaler  = reflect.TypeOf((*Marshaler)(nil)).Elem()
+
+	errRecursiveEmbedding = errors.New("recursive embedding")
+	errUnsupportedType    = errors.New("unsupported type, want a struct or a map with string keys")
 )
 
-// getStructValues parses interface v, returns its field list with fields' string value.
-func getStructValues(v interface{}) (vs []*field) {
-	vs = []*field{}
+// getStructValues parses interface v, returns its field list with fields' string value. Maps
+// with string keys are accepted as well, whose keys are used as field names. Keys
+// produced by more than one field are resolved by the dominance rules of encoding/json and
+// reported as collisions.
+func getStructValues(v interface{}) ([]*field, []*collision, error) {
+	fields, err := getValues(reflect.ValueOf(v), map[visit]bool{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		fi, fj := fields[i], fields[j]
+		if fi.name != fj.name {
+			return fi.name < fj.name
+		}
+		if len(fi.idx) != len(fj.idx) {
+			return len(fi.idx) < len(fj.idx)
+		}
+		return fi.tagged && !fj.tagged
+	})
+
+	vs := []*field{}
+	var collisions []*collision
+	for i, j := 0, 0; i < len(fields); i = j {
+		for j = i + 1; j < len(fields) && fields[j].name == fields[i].name; j++ {
+		}
+
+		f, ok := dominantField(fields[i:j])
+		if ok {
+			vs = append(vs, &field{
+				name:  f.name,
+				value: f.value,
+				kind:  f.kind,
+			})
+		}
+
+		if j-i > 1 {
+			c := &collision{name: fields[i].name}
+			for _, f := range fields[i:j] {
+				c.paths = append(c.paths, f.path)
+			}
+			collisions = append(collisions, c)
+		}
+	}
+
+	return vs, collisions, nil
+}
+
+// dominantField returns the dominant field of fields having the same key, which are sorted
+// by depth and tag presence. Like encoding/json, the shallowest field wins and a tagged field
+// beats untagged ones at the same depth. If there is still a tie, no field is dominant.
+func dominantField(fields []*field) (*field, bool) {
+	if len(fields) > 1 && len(fields[0].idx) == len(fields[1].idx) && fields[0].tagged == fields[1].tagged {
+		return nil, false
+	}
+	return fields[0], true
+}
+
+// visit is a pointer being flattened. Its type is kept since a struct and its first field share
+// the address.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// getValues returns the field list of struct value val with fields' string value. Fields
+// declared with interface types are resolved on their concrete values. Pointers being
+// flattened are recorded in visited to stop cycles through interfaces, while values of the
+// same type nested in each other are finite and flattened.
+func getValues(val reflect.Value, visited map[visit]bool) ([]*field, error) {
+	vs := []*field{}
 
-	val := reflect.ValueOf(v)
 	for val.Kind() == reflect.Interface || val.Kind() == reflect.Ptr {
 		if val.IsNil() {
-			return
+			return vs, nil
+		}
+		if val.Kind() == reflect.Ptr {
+			v := visit{ptr: val.Pointer(), typ: val.Type()}
+			if visited[v] {
+				return nil, &FieldError{Type: val.Type().Elem(), Err: errRecursiveEmbedding}
+			}
+			visited[v] = true
+			defer delete(visited, v)
 		}
 		val = val.Elem()
 	}
-
 	if !val.IsValid() {
-		return
+		return vs, nil
 	}
 
-	fields := parseStruct(val.Type())
+	typ := val.Type()
+	if val.Kind() == reflect.Map && typ.Key().Kind() == reflect.String {
+		return getMapValues(val), nil
+	}
+	if val.Kind() != reflect.Struct {
+		return nil, &FieldError{Type: typ, Err: errUnsupportedType}
+	}
+
+	fields, err := parseStruct(typ)
+	if err != nil {
+		return nil, err
+	}
 
 	for _, f := range fields {
+		// like encoding/json, fields promoted through nil embedded pointers are omitted
+		if promotedThroughNil(val, f.idx) {
+			continue
+		}
+
+		if f.conv.dynamic {
+			dvs, err := getDynamicValues(val, f, visited)
+			if err != nil {
+				return nil, err
+			}
+			vs = append(vs, dvs...)
+			continue
+		}
+
 		value := getStringValue(val, f.idx, &f.conv)
+		kind := f.kind
+		if len(value) == 0 && !indirect(fieldByIndex(val, f.idx)).IsValid() {
+			kind = nullKind
+		}
 		vs = append(vs, &field{
-			name:  f.name,
-			value: value,
+			name:   f.name,
+			value:  value,
+			kind:   kind,
+			idx:    f.idx,
+			tagged: f.tagged,
+			path:   f.path,
 		})
 	}
 
-	return
+	return vs, nil
+}
+
+// getDynamicValues resolves the interface typed field f of struct value val by the type of
+// its concrete value, using the same conversion rules as statically typed fields.
+func getDynamicValues(val reflect.Value, f *field, visited map[visit]bool) ([]*field, error) {
+	resolved := &field{
+		name:   f.name,
+		idx:    f.idx,
+		tagged: f.tagged,
+		path:   f.path,
+	}
+
+	// pointers to fv are kept, so getValues records them
+	fv := fieldByIndex(val, f.idx)
+	iv := indirect(fv)
+	if !iv.IsValid() {
+		resolved.kind = nullKind
+		return []*field{resolved}, nil
+	}
+
+	if value, kind, ok := convertValue(iv); ok {
+		resolved.value = value
+		resolved.kind = kind
+		return []*field{resolved}, nil
+	}
+
+	if iv.Kind() != reflect.Struct || !f.anonymous {
+		return nil, nil
+	}
+
+	nested, err := getValues(fv, visited)
+	if fe, ok := err.(*FieldError); ok {
+		return nil, &FieldError{Path: joinPath(f.path, fe.Path), Type: fe.Type, Err: fe.Err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// nested fields are placed under the interface field
+	for _, n := range nested {
+		n.idx = append(append([]int{}, f.idx...), n.idx...)
+		n.path = joinPath(f.path, n.path)
+	}
+
+	return nested, nil
+}
+
+// joinPath joins field paths by ".".
+func joinPath(path, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+	if len(name) == 0 {
+		return path
+	}
+	return path + "." + name
+}
+
+// getMapValues returns the field list of map value val, which has string keys. Map values are
+// converted by the same rules as struct fields, values which can't be converted are ignored.
+func getMapValues(val reflect.Value) []*field {
+	vs := []*field{}
+	for _, k := range val.MapKeys() {
+		name := k.String()
+
+		ev := indirect(val.MapIndex(k))
+		if !ev.IsValid() {
+			vs = append(vs, &field{name: name, kind: nullKind, path: name})
+			continue
+		}
+
+		if value, kind, ok := convertValue(ev); ok {
+			vs = append(vs, &field{name: name, value: value, kind: kind, path: name})
+		}
+	}
+
+	return vs
+}
+
+// convertValue converts val to string by the type of it. It returns false if val can't be
+// converted.
+func convertValue(val reflect.Value) (string, valueKind, bool) {
+	typ := val.Type()
+	conv := conversion{
+		stringable:  isStringable(typ),
+		marshalable: isMarshalable(typ),
+	}
+
+	if conv.stringable || conv.marshalable || isConvertable(typ) {
+		return getStringValue(val, []int{}, &conv), kindOf(typ, conv), true
+	}
+
+	return "", stringKind, false
+}
+
+// indirect follows interfaces and pointers of val. It returns the zero Value if a nil is met.
+func indirect(val reflect.Value) reflect.Value {
+	for val.Kind() == reflect.Interface || val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return reflect.Value{}
+		}
+		val = val.Elem()
+	}
+	return val
+}
+
+// fieldByIndex returns the nested field of struct value val by index sequence idx. It returns
+// the zero Value if a nil pointer or interface is met on the way.
+// promotedThroughNil reports if the field of struct value val at idx is promoted through an
+// embedded pointer which is nil.
+func promotedThroughNil(val reflect.Value, idx []int) bool {
+	return len(idx) > 1 && !indirect(fieldByIndex(val, idx[:len(idx)-1])).IsValid()
+}
+
+func fieldByIndex(val reflect.Value, idx []int) reflect.Value {
+	for _, i := range idx {
+		val = indirect(val)
+		if !val.IsValid() {
+			return val
+		}
+		val = val.Field(i)
+	}
+	return val
 }
 
 func marshalValue(val reflect.Value) string {
-	if v, ok := val.Interface().(Marshaler); ok {
-		return v.MarshalQsign()
+	if val.CanInterface() {
+		if v, ok := val.Interface().(Marshaler); ok {
+			return v.MarshalQsign()
+		}
 	}
 
 	if !val.CanAddr() {
@@ -74,6 +333,24 @@ func marshalValue(val reflect.Value) string {
 	return marshalValue(val.Addr())
 }
 
+func stringValue(val reflect.Value) string {
+	if val.Kind() == reflect.String {
+		return val.String()
+	}
+
+	if val.CanInterface() {
+		if v, ok := val.Interface().(stringable); ok {
+			return v.String()
+		}
+	}
+
+	if !val.CanAddr() {
+		return ""
+	}
+
+	return stringValue(val.Addr())
+}
+
 // getStringValue returns the string value of val. If depth is great than 0, val must be a struct,
 // it will find string value from the next depth level.
 func getStringValue(val reflect.Value, depth []int, conv *conversion) (r string) {
@@ -94,7 +371,7 @@ func getStringValue(val reflect.Value, depth []int, conv *conversion) (r string)
 	}
 
 	if conv.stringable {
-		return val.String()
+		return stringValue(val)
 	}
 
 	switch val.Kind() {
@@ -112,15 +389,19 @@ func getStringValue(val reflect.Value, depth []int, conv *conversion) (r string)
 }
 
 // parseStruct parses input type, store its field list in a map for use in the next time.
-func parseStruct(typ reflect.Type) []*field {
+func parseStruct(typ reflect.Type) ([]*field, error) {
 	typeInfoLock.RLock()
 	fields, ok := typeInfoMap[typ]
 	typeInfoLock.RUnlock()
 	if ok {
-		return fields
+		return fields, nil
+	}
+
+	fields, err := parseFieldsFromType(typ, []int{}, "", map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
 	}
 
-	fields = parseFieldsFromType(typ, []int{})
 	sort.Slice(fields, func(i, j int) bool {
 		return fields[i].name < fields[j].name
 	})
@@ -128,67 +409,99 @@ func parseStruct(typ reflect.Type) []*field {
 	typeInfoLock.Lock()
 	typeInfoMap[typ] = fields
 	typeInfoLock.Unlock()
-	return fields
+	return fields, nil
 }
 
-// parseFieldsFromType parses the input type, returns its field list.
-func parseFieldsFromType(typ reflect.Type, idx []int) []*field {
+// parseFieldsFromType parses the input type, returns its field list. Struct types on the
+// current embedding path are recorded in visited, an embedded struct which is already on the
+// path makes an infinite recursion, so an error is returned. Field paths are prefixed with
+// path, the Go field names of the embedding path.
+func parseFieldsFromType(typ reflect.Type, idx []int, path string, visited map[reflect.Type]bool) ([]*field, error) {
 	res := []*field{}
 	typ = findFinalType(typ)
 
-	if typ.Kind() == reflect.Struct {
-		n := typ.NumField()
-		for i := 0; i < n; i++ {
-			f := typ.Field(i)
-			ft := findFinalType(f.Type)
+	if typ.Kind() != reflect.Struct {
+		return res, nil
+	}
 
-			name, skip := getFieldName(f)
-			if skip || len(name) == 0 {
-				continue
-			}
+	if visited[typ] {
+		return nil, &FieldError{Path: path, Type: typ, Err: errRecursiveEmbedding}
+	}
+	visited[typ] = true
+	defer delete(visited, typ)
 
-			var canMarshal, canString, canConvert bool
-			if isMarshalable(ft) {
-				canMarshal = true
-			}
+	n := typ.NumField()
+	for i := 0; i < n; i++ {
+		f := typ.Field(i)
+		ft := findFinalType(f.Type)
 
-			if isStringable(ft) {
-				canString = true
-			}
+		name, skip := getFieldName(f)
+		if skip || len(name) == 0 {
+			continue
+		}
+		_, tagged := lookupTag(f)
+
+		fpath := joinPath(path, f.Name)
+
+		// copy the index sequence, nested fields must not share the underlying array
+		fidx := make([]int, len(idx), len(idx)+1)
+		copy(fidx, idx)
+		fidx = append(fidx, i)
+
+		// Interface typed fields are resolved by their concrete values later.
+		if ft.Kind() == reflect.Interface {
+			res = append(res, &field{
+				name:      name,
+				idx:       fidx,
+				conv:      conversion{dynamic: true},
+				anonymous: f.Anonymous,
+				tagged:    tagged,
+				path:      fpath,
+			})
+			continue
+		}
 
-			if isConvertable(ft) {
-				canConvert = true
-			}
+		var canMarshal, canString, canConvert bool
+		if isMarshalable(ft) {
+			canMarshal = true
+		}
+
+		if isStringable(ft) {
+			canString = true
+		}
+
+		if isConvertable(ft) {
+			canConvert = true
+		}
 
-			if canMarshal || canString || canConvert {
-				res = append(res, &field{
-					name: name,
-					idx:  append(idx, i),
-					conv: conversion{
-						stringable:  canString,
-						marshalable: canMarshal,
-					},
-				})
-			} else if ft.Kind() == reflect.Struct && f.Anonymous {
-				res = append(res, parseFieldsFromType(ft, append(idx, i))...)
+		if canMarshal || canString || canConvert {
+			conv := conversion{
+				stringable:  canString,
+				marshalable: canMarshal,
 			}
+			res = append(res, &field{
+				name:   name,
+				idx:    fidx,
+				conv:   conv,
+				kind:   kindOf(ft, conv),
+				tagged: tagged,
+				path:   fpath,
+			})
+		} else if ft.Kind() == reflect.Struct && f.Anonymous {
+			nested, err := parseFieldsFromType(ft, fidx, fpath, visited)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, nested...)
 		}
 	}
 
-	return res
+	return res, nil
 }
 
 // getFieldName returns a struct field's name according to field's tag.
 func getFieldName(field reflect.StructField) (v string, skip bool) {
-	var ok bool
-
-	for _, tag := range tags {
-		v, ok = field.Tag.Lookup(tag)
-		if ok {
-			break
-		}
-	}
-
+	v, ok := lookupTag(field)
 	if !ok {
 		v = field.Name
 		return
@@ -202,8 +515,20 @@ func getFieldName(field reflect.StructField) (v string, skip bool) {
 	return
 }
 
+// lookupTag returns the value of the first tag found on field, in the order of tags.
+func lookupTag(field reflect.StructField) (v string, ok bool) {
+	for _, tag := range tags {
+		v, ok = field.Tag.Lookup(tag)
+		if ok {
+			return
+		}
+	}
+	return
+}
+
+// findFinalType returns the type which typ points to, through any levels of pointers.
 func findFinalType(typ reflect.Type) reflect.Type {
-	if typ.Kind() == reflect.Interface || typ.Kind() == reflect.Ptr {
+	for typ.Kind() == reflect.Ptr {
 		typ = typ.Elem()
 	}
 	return typ
@@ -219,7 +544,7 @@ func isStringable(typ reflect.Type) bool {
 		return true
 	}
 
-	if typ.Kind() == reflect.Interface || typ.Kind() == reflect.Ptr {
+	if typ.Kind() == reflect.Ptr {
 		return isStringable(typ.Elem())
 	}
 
@@ -243,13 +568,34 @@ func isImplements(typ, match reflect.Type) bool {
 		}
 	}
 
-	if typ.Kind() == reflect.Interface || typ.Kind() == reflect.Ptr {
+	if typ.Kind() == reflect.Ptr {
 		return isImplements(typ.Elem(), match)
 	}
 
 	return false
 }
 
+// kindOf returns the kind of values of type typ converted by conv. Values of marshalable and
+// stringable types are always strings.
+func kindOf(typ reflect.Type, conv conversion) valueKind {
+	if conv.marshalable || conv.stringable {
+		return stringKind
+	}
+
+	switch findFinalType(typ).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return numberKind
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return numberKind
+	case reflect.Float32, reflect.Float64:
+		return numberKind
+	case reflect.Bool:
+		return boolKind
+	default:
+		return stringKind
+	}
+}
+
 // isConvertable checks if a type can be converted to string.
 func isConvertable(typ reflect.Type) bool {
 	typ = findFinalType(typ)
@@ -1,7 +1,9 @@
 package qsign
 
 import (
+	"fmt"
 	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -190,15 +192,18 @@ func TestReflectionGetFieldName(t *testing.T) {
 func TestReflectionParseFieldsFromType(t *testing.T) {
 	input := structTypeForTest{}
 	expect := []*field{
-		{name: "Name", idx: []int{0}, conv: conversion{stringable: true}},
-		{name: "value", idx: []int{1}, conv: conversion{stringable: false}},
-		{name: "address", idx: []int{3}, conv: conversion{stringable: true}},
-		{name: "marshal", idx: []int{4}, conv: conversion{marshalable: true}},
-		{name: "MyStr", idx: []int{5}, conv: conversion{stringable: true}},
-		{name: "support_json_tag", idx: []int{6, 0}, conv: conversion{stringable: true}},
+		{name: "Name", idx: []int{0}, conv: conversion{stringable: true}, path: "Name"},
+		{name: "value", idx: []int{1}, conv: conversion{stringable: false}, kind: numberKind, tagged: true, path: "Value"},
+		{name: "address", idx: []int{3}, conv: conversion{stringable: true}, tagged: true, path: "Addr"},
+		{name: "marshal", idx: []int{4}, conv: conversion{marshalable: true}, tagged: true, path: "Marshal"},
+		{name: "MyStr", idx: []int{5}, conv: conversion{stringable: true}, path: "MyStr"},
+		{name: "support_json_tag", idx: []int{6, 0}, conv: conversion{stringable: true}, tagged: true, path: "nestedStructForTest.JSON"},
 	}
 
-	actual := parseFieldsFromType(reflect.TypeOf(input), []int{})
+	actual, err := parseFieldsFromType(reflect.TypeOf(input), []int{}, "", map[reflect.Type]bool{})
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
 	if !reflect.DeepEqual(actual, expect) {
 		t.Errorf("expect parse result equals, expect %#v, actual %#v", expect, actual)
 	}
@@ -207,12 +212,12 @@ func TestReflectionParseFieldsFromType(t *testing.T) {
 func TestReflectionParseStruct(t *testing.T) {
 	input := structTypeForTest{}
 	expect := []*field{
-		{name: "MyStr", idx: []int{5}, conv: conversion{stringable: true}},
-		{name: "Name", idx: []int{0}, conv: conversion{stringable: true}},
-		{name: "address", idx: []int{3}, conv: conversion{stringable: true}},
-		{name: "marshal", idx: []int{4}, conv: conversion{marshalable: true}},
-		{name: "support_json_tag", idx: []int{6, 0}, conv: conversion{stringable: true}},
-		{name: "value", idx: []int{1}, conv: conversion{stringable: false}},
+		{name: "MyStr", idx: []int{5}, conv: conversion{stringable: true}, path: "MyStr"},
+		{name: "Name", idx: []int{0}, conv: conversion{stringable: true}, path: "Name"},
+		{name: "address", idx: []int{3}, conv: conversion{stringable: true}, tagged: true, path: "Addr"},
+		{name: "marshal", idx: []int{4}, conv: conversion{marshalable: true}, tagged: true, path: "Marshal"},
+		{name: "support_json_tag", idx: []int{6, 0}, conv: conversion{stringable: true}, tagged: true, path: "nestedStructForTest.JSON"},
+		{name: "value", idx: []int{1}, conv: conversion{stringable: false}, kind: numberKind, tagged: true, path: "Value"},
 	}
 
 	typ := reflect.TypeOf(input)
@@ -221,7 +226,10 @@ func TestReflectionParseStruct(t *testing.T) {
 		t.Errorf("expect typeInfoMap has no items")
 	}
 
-	actual := parseStruct(typ)
+	actual, err := parseStruct(typ)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
 	if !reflect.DeepEqual(actual, expect) {
 		t.Errorf("expect parse result equals, expect %#v, actual %#v", expect, actual)
 	}
@@ -230,7 +238,7 @@ func TestReflectionParseStruct(t *testing.T) {
 		t.Errorf("expect typeInfoMap has type cache")
 	}
 
-	actual = parseStruct(typ)
+	actual, _ = parseStruct(typ)
 	if !reflect.DeepEqual(actual, expect) {
 		t.Errorf("expect parse result equals, expect %#v, actual %#v", expect, actual)
 	}
@@ -270,9 +278,9 @@ func TestReflectionGetStructValues(t *testing.T) {
 				{name: "MyStr", value: s.String()},
 				{name: "Name", value: ""},
 				{name: "address", value: realString},
-				{name: "marshal", value: ""},
+				{name: "marshal", value: "", kind: nullKind},
 				{name: "support_json_tag", value: "nested"},
-				{name: "value", value: "7"},
+				{name: "value", value: "7", kind: numberKind},
 			},
 		},
 		{
@@ -298,15 +306,358 @@ func TestReflectionGetStructValues(t *testing.T) {
 				{name: "address", value: realString},
 				{name: "marshal", value: "marshal"},
 				{name: "support_json_tag", value: "nested"},
-				{name: "value", value: "7"},
+				{name: "value", value: "7", kind: numberKind},
 			},
 		},
 	}
 
 	for _, c := range cases {
-		actual := getStructValues(c.input)
+		actual, _, err := getStructValues(c.input)
+		if err != nil {
+			t.Errorf("expect no error, actual %v", err)
+		}
 		if !reflect.DeepEqual(actual, c.expect) {
 			t.Errorf("expect parse result equals, expect %#v, actual %#v", c.expect, actual)
 		}
 	}
 }
+
+type myCents int64
+
+func (c myCents) String() string {
+	return fmt.Sprintf("%d.%02d", c/100, c%100)
+}
+
+type anyForTest interface{}
+
+type dynamicStructForTest struct {
+	Extra  interface{}  `qsign:"extra"`
+	Amount fmt.Stringer `qsign:"amount"`
+	Marsh  interface{}  `qsign:"marsh"`
+	Nested interface{}  `qsign:"nested"`
+	anyForTest
+}
+
+func TestReflectionGetDynamicValues(t *testing.T) {
+	var realString = "this is a string type var"
+
+	cases := []struct {
+		input  interface{}
+		expect []*field
+	}{
+		{
+			input: dynamicStructForTest{},
+			expect: []*field{
+				{name: "amount", kind: nullKind},
+				{name: "anyForTest", kind: nullKind},
+				{name: "extra", kind: nullKind},
+				{name: "marsh", kind: nullKind},
+				{name: "nested", kind: nullKind},
+			},
+		},
+		{
+			input: dynamicStructForTest{
+				Extra:      7,
+				Amount:     myCents(1050),
+				Marsh:      &myMarshaler{Name: "marshal"},
+				Nested:     nestedStructForTest{JSON: "named struct field will be ignored"},
+				anyForTest: nestedStructForTest{JSON: "flattened"},
+			},
+			expect: []*field{
+				{name: "amount", value: "10.50"},
+				{name: "extra", value: "7", kind: numberKind},
+				{name: "marsh", value: "marshal"},
+				{name: "support_json_tag", value: "flattened"},
+			},
+		},
+		{
+			input: &dynamicStructForTest{
+				Extra:      []int{1, 2},
+				Amount:     myString("stringer"),
+				Marsh:      myMarshaler{Name: "not addressable"},
+				Nested:     &realString,
+				anyForTest: true,
+			},
+			expect: []*field{
+				{name: "amount", value: "stringer"},
+				{name: "anyForTest", value: "true", kind: boolKind},
+				{name: "marsh", value: ""},
+				{name: "nested", value: realString},
+			},
+		},
+	}
+
+	for i, c := range cases {
+		actual, _, err := getStructValues(c.input)
+		if err != nil {
+			t.Errorf("case %d expect no error, actual %v", i, err)
+		}
+		if !reflect.DeepEqual(actual, c.expect) {
+			t.Errorf("case %d expect parse result equals, expect %#v, actual %#v", i, c.expect, actual)
+		}
+	}
+}
+
+type recursiveNode struct {
+	*recursiveNode
+	ID int
+}
+
+type recursiveA struct {
+	*recursiveB
+	A string
+}
+
+type recursiveB struct {
+	recursiveA
+	B string
+}
+
+type siblingEmbedded struct {
+	nestedStructForTest
+	Other struct {
+		nestedStructForTest
+	}
+}
+
+type recursiveDynamic struct {
+	anyForTest
+	ID int
+}
+
+type pointerLevelsForTest struct {
+	One   *string    `qsign:"one"`
+	Two   **string   `qsign:"two"`
+	Three ***int     `qsign:"three"`
+	Str   **myString `qsign:"str"`
+	Nil   **string   `qsign:"nil"`
+}
+
+func TestReflectionRecursiveEmbedding(t *testing.T) {
+	cycle := &recursiveDynamic{ID: 1}
+	cycle.anyForTest = cycle
+
+	indirectCycle := &recursiveDynamic{ID: 1}
+	indirectCycle.anyForTest = &recursiveDynamic{ID: 2, anyForTest: indirectCycle}
+
+	cases := []struct {
+		input     interface{}
+		expectErr bool
+	}{
+		{recursiveNode{ID: 1}, true},
+		{&recursiveA{A: "a"}, true},
+		{recursiveB{B: "b"}, true},
+		{siblingEmbedded{}, false},
+		{recursiveDynamic{ID: 1}, false},
+		{recursiveDynamic{anyForTest: recursiveDynamic{ID: 2}}, false},
+		{recursiveDynamic{anyForTest: &recursiveDynamic{anyForTest: recursiveDynamic{ID: 3}}}, false},
+		{cycle, true},
+		{*cycle, true},
+		{indirectCycle, true},
+		{recursiveDynamic{anyForTest: nestedStructForTest{}}, false},
+	}
+
+	for i, c := range cases {
+		_, _, err := getStructValues(c.input)
+		if (err != nil) != c.expectErr {
+			t.Errorf("case %d expect error %v, actual %v", i, c.expectErr, err)
+		}
+	}
+
+	// the shallower ID wins over the one nested in the interface
+	vs, _, _ := getStructValues(recursiveDynamic{anyForTest: recursiveDynamic{ID: 2}, ID: 1})
+	expect := []*field{{name: "ID", value: "1", kind: numberKind}, {name: "anyForTest", kind: nullKind}}
+	if !reflect.DeepEqual(vs, expect) {
+		t.Errorf("expect parse result equals, expect %#v, actual %#v", expect, vs)
+	}
+
+	typ := reflect.TypeOf(recursiveNode{})
+	if _, ok := typeInfoMap[typ]; ok {
+		t.Errorf("expect recursive type is not cached")
+	}
+}
+
+func TestReflectionPointerLevels(t *testing.T) {
+	s := "string"
+	ps := &s
+	n := 3
+	pn := &n
+	ppn := &pn
+	var ms myString = "my string"
+	pms := &ms
+
+	actual, _, err := getStructValues(&pointerLevelsForTest{
+		One:   &s,
+		Two:   &ps,
+		Three: &ppn,
+		Str:   &pms,
+	})
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+
+	expect := []*field{
+		{name: "nil", value: "", kind: nullKind},
+		{name: "one", value: s},
+		{name: "str", value: string(ms)},
+		{name: "three", value: "3", kind: numberKind},
+		{name: "two", value: s},
+	}
+	if !reflect.DeepEqual(actual, expect) {
+		t.Errorf("expect parse result equals, expect %#v, actual %#v", expect, actual)
+	}
+}
+
+type taggedNameForTest struct {
+	Other string `qsign:"Name"`
+}
+
+type untaggedNameForTest struct {
+	Name string
+}
+
+type tiedNameForTest struct {
+	Value string `json:"Name"`
+}
+
+func TestReflectionDominantField(t *testing.T) {
+	cases := []struct {
+		input      interface{}
+		expect     []*field
+		collisions []*collision
+	}{
+		{
+			input: struct {
+				*weixinPayApp
+				AppID string `qsign:"appId"`
+			}{&weixinPayApp{AppID: "inner"}, "outer"},
+			expect: []*field{{name: "appId", value: "outer"}},
+			collisions: []*collision{
+				{name: "appId", paths: []string{"AppID", "weixinPayApp.AppID"}},
+			},
+		},
+		{
+			input: struct {
+				untaggedNameForTest
+				taggedNameForTest
+			}{untaggedNameForTest{"untagged"}, taggedNameForTest{"tagged"}},
+			expect: []*field{{name: "Name", value: "tagged"}},
+			collisions: []*collision{
+				{name: "Name", paths: []string{"taggedNameForTest.Other", "untaggedNameForTest.Name"}},
+			},
+		},
+		{
+			input: struct {
+				taggedNameForTest
+				tiedNameForTest
+				ID int
+			}{taggedNameForTest{"a"}, tiedNameForTest{"b"}, 1},
+			expect: []*field{{name: "ID", value: "1", kind: numberKind}},
+			collisions: []*collision{
+				{name: "Name", paths: []string{"taggedNameForTest.Other", "tiedNameForTest.Value"}},
+			},
+		},
+		{
+			input: struct {
+				anyForTest
+				Name string
+			}{taggedNameForTest{"dynamic"}, "outer"},
+			expect: []*field{{name: "Name", value: "outer"}},
+			collisions: []*collision{
+				{name: "Name", paths: []string{"Name", "anyForTest.Other"}},
+			},
+		},
+	}
+
+	for i, c := range cases {
+		actual, collisions, err := getStructValues(c.input)
+		if err != nil {
+			t.Errorf("case %d expect no error, actual %v", i, err)
+		}
+		if !reflect.DeepEqual(actual, c.expect) {
+			t.Errorf("case %d expect parse result equals, expect %#v, actual %#v", i, c.expect, actual)
+		}
+		if !reflect.DeepEqual(collisions, c.collisions) {
+			t.Errorf("case %d expect collisions equal, expect %#v, actual %#v", i, c.collisions, collisions)
+		}
+	}
+}
+
+func TestReflectionUnsupportedTypes(t *testing.T) {
+	cases := []interface{}{
+		42,
+		"a=1",
+		[]string{"a"},
+		map[int]string{1: "keys must be strings"},
+		func() {},
+	}
+
+	for i, c := range cases {
+		_, _, err := getStructValues(c)
+		fe, ok := err.(*FieldError)
+		if !ok || fe.Type != reflect.TypeOf(c) || fe.Err != errUnsupportedType {
+			t.Errorf("case %d expect unsupported type %T, actual %v", i, c, err)
+		}
+	}
+
+	for i, c := range []interface{}{nil, (*struct{ A string })(nil), struct{}{}, map[string]int{}} {
+		if _, _, err := getStructValues(c); err != nil {
+			t.Errorf("case %d expect no error, actual %v", i, err)
+		}
+	}
+}
+
+func TestReflectionGetMapValues(t *testing.T) {
+	var realString = "this is a string type var"
+
+	cases := []struct {
+		input  interface{}
+		expect []*field
+	}{
+		{
+			input:  map[string]string{},
+			expect: []*field{},
+		},
+		{
+			input: map[string]string{"b": "2", "a": "1"},
+			expect: []*field{
+				{name: "a", value: "1", path: "a"},
+				{name: "b", value: "2", path: "b"},
+			},
+		},
+		{
+			input: &map[myString]interface{}{
+				"int":      7,
+				"nil":      nil,
+				"pointer":  &realString,
+				"stringer": myCents(1050),
+				"slice":    []int{1},
+				"struct":   nestedStructForTest{},
+			},
+			expect: []*field{
+				{name: "int", value: "7", kind: numberKind, path: "int"},
+				{name: "nil", kind: nullKind, path: "nil"},
+				{name: "pointer", value: realString, path: "pointer"},
+				{name: "stringer", value: "10.50", path: "stringer"},
+			},
+		},
+	}
+
+	for i, c := range cases {
+		vs, _, err := getStructValues(c.input)
+		if err != nil {
+			t.Errorf("case %d expect no error, actual %v", i, err)
+		}
+
+		actual := getMapValues(reflect.Indirect(reflect.ValueOf(c.input)))
+		sort.Slice(actual, func(i, j int) bool {
+			return actual[i].name < actual[j].name
+		})
+		if !reflect.DeepEqual(actual, c.expect) {
+			t.Errorf("case %d expect parse result equals, expect %#v, actual %#v", i, c.expect, actual)
+		}
+		if len(vs) != len(c.expect) {
+			t.Errorf("case %d expect %d values, actual %d", i, len(c.expect), len(vs))
+		}
+	}
+}
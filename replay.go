@@ -0,0 +1,284 @@
+package qsign
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTolerance is the default tolerance of timestamps, recommended by most APIs.
+	DefaultTolerance = 5 * time.Minute
+
+	// DefaultNonceCapacity is the capacity of the default in-memory NonceStore.
+	DefaultNonceCapacity = 100000
+)
+
+// NonceStore records nonces of verified messages, so replays of them are rejected.
+type NonceStore interface {
+	// Use records nonce until expiry. It returns false if nonce is recorded and not expired.
+	Use(nonce string, expiry time.Time) (bool, error)
+}
+
+// checkReplay checks the timestamp and the nonce in fields.
+func (q *Qsign) checkReplay(fields []*field) error {
+	if len(q.timestampKey) == 0 && len(q.nonceKey) == 0 {
+		return nil
+	}
+
+	now := q.clock()
+	expiry := now.Add(q.tolerance)
+
+	if len(q.timestampKey) > 0 {
+		value, ok := fieldValue(fields, q.timestampKey)
+		if !ok {
+			return &FieldError{Path: q.timestampKey, Err: errMissingField}
+		}
+		t, err := q.timestampFormat.parse(value)
+		if err != nil {
+			return &FieldError{Path: q.timestampKey, Err: fmt.Errorf("invalid timestamp %q", value)}
+		}
+
+		if err := checkTimestamp(t, q.tolerance, now); err != nil {
+			return err
+		}
+		expiry = t.Add(q.tolerance)
+	}
+
+	if len(q.nonceKey) > 0 {
+		nonce, ok := fieldValue(fields, q.nonceKey)
+		if !ok {
+			return &FieldError{Path: q.nonceKey, Err: errMissingField}
+		}
+
+		fresh, err := q.nonceStore.Use(nonce, expiry)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrReplay
+		}
+	}
+
+	return nil
+}
+
+// checkTimestamp checks if t is within tolerance of now.
+func checkTimestamp(t time.Time, tolerance time.Duration, now time.Time) error {
+	if d := now.Sub(t); d > tolerance || d < -tolerance {
+		return ErrExpired
+	}
+	return nil
+}
+
+// fieldValue returns the value of key in fields.
+func fieldValue(fields []*field, key string) (string, bool) {
+	for _, f := range fields {
+		if f.name == key {
+			return f.value, true
+		}
+	}
+	return "", false
+}
+
+// MemoryNonceStore is a NonceStore in memory. Expired nonces are dropped as new nonces come.
+// It's safe for concurrent use.
+type MemoryNonceStore struct {
+	mu       sync.Mutex
+	capacity int
+	nonces   map[string]time.Time
+	expiries nonceHeap
+
+	// now is the time nonces expire by, replaced in tests.
+	now func() time.Time
+}
+
+// NewMemoryNonceStore returns a *MemoryNonceStore holding up to capacity nonces which are not
+// expired. Use returns an error if it's full, rather than forgetting nonces which may be
+// replayed. A capacity not greater than zero means no limit.
+func NewMemoryNonceStore(capacity int) *MemoryNonceStore {
+	return &MemoryNonceStore{
+		capacity: capacity,
+		nonces:   map[string]time.Time{},
+		now:      time.Now,
+	}
+}
+
+// Use records nonce until expiry. It returns false if nonce is recorded and not expired.
+func (s *MemoryNonceStore) Use(nonce string, expiry time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge()
+
+	if _, ok := s.nonces[nonce]; ok {
+		return false, nil
+	}
+	if s.capacity > 0 && len(s.nonces) >= s.capacity {
+		return false, ErrNonceStoreFull
+	}
+
+	s.add(nonce, expiry)
+	return true, nil
+}
+
+// Len returns the number of recorded nonces, including expired ones not dropped yet.
+func (s *MemoryNonceStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.nonces)
+}
+
+func (s *MemoryNonceStore) add(nonce string, expiry time.Time) {
+	s.nonces[nonce] = expiry
+	heap.Push(&s.expiries, nonceEntry{nonce: nonce, expiry: expiry})
+}
+
+// purge drops expired nonces.
+func (s *MemoryNonceStore) purge() {
+	now := s.now()
+	for len(s.expiries) > 0 && !s.expiries[0].expiry.After(now) {
+		e := heap.Pop(&s.expiries).(nonceEntry)
+		delete(s.nonces, e.nonce)
+	}
+}
+
+type nonceEntry struct {
+	nonce  string
+	expiry time.Time
+}
+
+// nonceHeap is a min-heap of nonces by expiry.
+type nonceHeap []nonceEntry
+
+func (h nonceHeap) Len() int            { return len(h) }
+func (h nonceHeap) Less(i, j int) bool  { return h[i].expiry.Before(h[j].expiry) }
+func (h nonceHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *nonceHeap) Push(x interface{}) { *h = append(*h, x.(nonceEntry)) }
+func (h *nonceHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// FileNonceStore is a NonceStore backed by a file, so nonces survive restarts. Nonces are
+// appended to the file as they're used, and expired ones are dropped from the file when it's
+// opened. It's safe for concurrent use, but not by multiple processes.
+type FileNonceStore struct {
+	mu   sync.Mutex
+	file *os.File
+	mem  *MemoryNonceStore
+}
+
+// OpenFileNonceStore opens or creates the FileNonceStore at path.
+func OpenFileNonceStore(path string) (*FileNonceStore, error) {
+	return openFileNonceStore(path, time.Now)
+}
+
+func openFileNonceStore(path string, now func() time.Time) (*FileNonceStore, error) {
+	mem := NewMemoryNonceStore(0)
+	mem.now = now
+
+	if err := loadNonces(path, mem); err != nil {
+		return nil, err
+	}
+
+	// rewrite the file with nonces which are not expired
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(file)
+	for nonce, expiry := range mem.nonces {
+		writeNonce(w, nonce, expiry)
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+
+	if file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+		return nil, err
+	}
+
+	return &FileNonceStore{file: file, mem: mem}, nil
+}
+
+// loadNonces loads nonces which are not expired from the file at path into mem.
+func loadNonces(path string, mem *MemoryNonceStore) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	now := mem.now()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("qsign: invalid nonce record %q", scanner.Text())
+		}
+		ts, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("qsign: invalid nonce record %q", scanner.Text())
+		}
+		nonce, err := strconv.Unquote(parts[1])
+		if err != nil {
+			return fmt.Errorf("qsign: invalid nonce record %q", scanner.Text())
+		}
+
+		if expiry := time.Unix(0, ts); expiry.After(now) {
+			mem.add(nonce, expiry)
+		}
+	}
+	return scanner.Err()
+}
+
+// writeNonce writes the record of nonce, which is quoted so it never breaks lines.
+func writeNonce(w *bufio.Writer, nonce string, expiry time.Time) {
+	w.WriteString(strconv.FormatInt(expiry.UnixNano(), 10))
+	w.WriteByte(' ')
+	w.WriteString(strconv.Quote(nonce))
+	w.WriteByte('\n')
+}
+
+// Use records nonce until expiry. It returns false if nonce is recorded and not expired.
+func (s *FileNonceStore) Use(nonce string, expiry time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fresh, err := s.mem.Use(nonce, expiry)
+	if err != nil || !fresh {
+		return fresh, err
+	}
+
+	w := bufio.NewWriter(s.file)
+	writeNonce(w, nonce, expiry)
+	if err := w.Flush(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Close closes the file of s.
+func (s *FileNonceStore) Close() error {
+	return s.file.Close()
+}
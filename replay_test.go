@@ -0,0 +1,188 @@
+package qsign
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQsignVerifyReplay(t *testing.T) {
+	now := time.Unix(1554208460, 0)
+	q := NewQsign(Options{
+		TimestampKey: "timestamp",
+		NonceKey:     "nonce_str",
+		Clock: func() time.Time {
+			return now
+		},
+	})
+
+	sign := func(data map[string]string) []byte {
+		signature, err := q.Sign(data)
+		if err != nil {
+			t.Fatalf("expect no error, actual %v", err)
+		}
+		return signature
+	}
+
+	data := map[string]string{"appid": "wxd930ea5d5a258f4f", "timestamp": "1554208400", "nonce_str": "ibuaiVcKdpRxkhJA"}
+	signature := sign(data)
+	if err := q.Verify(data, signature); err != nil {
+		t.Errorf("expect no error, actual %v", err)
+	}
+	if err := q.Verify(data, signature); err != ErrReplay {
+		t.Errorf("expect replay, actual %v", err)
+	}
+
+	forged := map[string]string{"appid": "wxd930ea5d5a258f4f", "timestamp": "1554208400", "nonce_str": "forged"}
+	if err := q.Verify(forged, signature); err != ErrSignatureMismatch {
+		t.Errorf("expect signature mismatch, actual %v", err)
+	}
+	forged["appid"] = "wx2421b1c4370ec43b"
+	if err := q.Verify(forged, sign(forged)); err != nil {
+		t.Errorf("expect nonce of forged message is not recorded, actual %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		timestamp string
+	}{
+		{"too old", "1554208159"},
+		{"too new", "1554208761"},
+		{"invalid", "now"},
+	}
+	for _, c := range cases {
+		data := map[string]string{"appid": "wxd930ea5d5a258f4f", "timestamp": c.timestamp, "nonce_str": c.name}
+		if err := q.Verify(data, sign(data)); err == nil {
+			t.Errorf("%s expect error, actual nil", c.name)
+		}
+	}
+
+	data = map[string]string{"appid": "wxd930ea5d5a258f4f", "timestamp": "1554208100", "nonce_str": "expired"}
+	if err := q.Verify(data, sign(data)); err != ErrExpired {
+		t.Errorf("expect expired, actual %v", err)
+	}
+
+	missing := map[string]string{"appid": "wxd930ea5d5a258f4f", "nonce_str": "no timestamp"}
+	var fe *FieldError
+	if err := q.Verify(missing, sign(missing)); !errors.As(err, &fe) || fe.Path != "timestamp" {
+		t.Errorf("expect error for missing timestamp, actual %v", err)
+	}
+	missing = map[string]string{"appid": "wxd930ea5d5a258f4f", "timestamp": "1554208460"}
+	if err := q.Verify(missing, sign(missing)); !errors.As(err, &fe) || fe.Path != "nonce_str" {
+		t.Errorf("expect error for missing nonce, actual %v", err)
+	}
+
+	invalid := map[string]string{"appid": "wxd930ea5d5a258f4f", "timestamp": "now", "nonce_str": "invalid"}
+	if err := q.Verify(invalid, sign(invalid)); !errors.As(err, &fe) || fe.Path != "timestamp" {
+		t.Errorf("expect error for invalid timestamp, actual %v", err)
+	}
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	now := time.Unix(1554208460, 0)
+	s := NewMemoryNonceStore(3)
+	s.now = func() time.Time { return now }
+
+	cases := []struct {
+		nonce  string
+		expiry time.Time
+		expect bool
+		err    error
+	}{
+		{"a", now.Add(time.Minute), true, nil},
+		{"a", now.Add(time.Hour), false, nil},
+		{"b", now.Add(2 * time.Minute), true, nil},
+		{"c", now.Add(time.Minute), true, nil},
+		{"d", now.Add(time.Minute), false, ErrNonceStoreFull},
+	}
+	for _, c := range cases {
+		fresh, err := s.Use(c.nonce, c.expiry)
+		if fresh != c.expect || err != c.err {
+			t.Errorf("%s expect %v, %v, actual %v, %v", c.nonce, c.expect, c.err, fresh, err)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	if fresh, err := s.Use("d", now.Add(time.Minute)); !fresh || err != nil {
+		t.Errorf("expect expired nonces are dropped, actual %v, %v", fresh, err)
+	}
+	if fresh, err := s.Use("a", now.Add(time.Minute)); !fresh || err != nil {
+		t.Errorf("expect expired a is accepted again, actual %v, %v", fresh, err)
+	}
+	if fresh, err := s.Use("a", now.Add(time.Minute)); fresh || err != nil {
+		t.Errorf("expect a is recorded again, actual %v, %v", fresh, err)
+	}
+	if s.Len() != 3 {
+		t.Errorf("expect 3 nonces, actual %d", s.Len())
+	}
+
+	now = now.Add(time.Hour)
+	if fresh, err := s.Use("b", now.Add(time.Minute)); !fresh || err != nil {
+		t.Errorf("expect expired nonce is dropped, actual %v, %v", fresh, err)
+	}
+	if s.Len() != 1 {
+		t.Errorf("expect 1 nonce, actual %d", s.Len())
+	}
+}
+
+func TestFileNonceStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qsign")
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nonces")
+
+	now := time.Unix(1554208460, 0)
+	clock := func() time.Time { return now }
+
+	s, err := openFileNonceStore(path, clock)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	for _, nonce := range []string{"a", "b\nc"} {
+		if fresh, err := s.Use(nonce, now.Add(time.Minute)); !fresh || err != nil {
+			t.Errorf("%q expect fresh, actual %v, %v", nonce, fresh, err)
+		}
+	}
+	s.Use("d", now.Add(time.Hour))
+	s.Close()
+
+	s, err = openFileNonceStore(path, clock)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	for _, nonce := range []string{"a", "b\nc", "d"} {
+		if fresh, err := s.Use(nonce, now.Add(time.Minute)); fresh || err != nil {
+			t.Errorf("%q expect recorded after reopen, actual %v, %v", nonce, fresh, err)
+		}
+	}
+	s.Close()
+
+	now = now.Add(2 * time.Minute)
+	s, err = openFileNonceStore(path, clock)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	if fresh, _ := s.Use("a", now.Add(time.Minute)); !fresh {
+		t.Errorf("expect expired nonce is dropped")
+	}
+	if fresh, _ := s.Use("d", now.Add(time.Minute)); fresh {
+		t.Errorf("expect d is recorded")
+	}
+	s.Close()
+
+	b, _ := ioutil.ReadFile(path)
+	if lines := strings.Count(string(b), "\n"); lines != 2 {
+		t.Errorf("expect expired nonces are dropped from file, actual %q", b)
+	}
+
+	ioutil.WriteFile(path, []byte("broken\n"), 0600)
+	if _, err := OpenFileNonceStore(path); err == nil {
+		t.Errorf("expect error for broken file, actual nil")
+	}
+}
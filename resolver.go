@@ -0,0 +1,33 @@
+package qsign
+
+import "context"
+
+// KeyResolver returns the secret to sign or verify pairs with, like the API key of the merchant
+// whose ID is in pairs. Pairs are filtered and sorted by key, like they're in the digest. For
+// raw data, pairs are empty.
+type KeyResolver func(pairs []Pair) (string, error)
+
+// ContextKeyResolver is like KeyResolver, but receives the context of signing.
+type ContextKeyResolver func(ctx context.Context, pairs []Pair) (string, error)
+
+// KeyByField returns a KeyResolver looking up secrets by the value of key in pairs, like
+// "mch_id". A *FieldError is returned if pairs have no such key.
+func KeyByField(key string, lookup func(value string) (string, error)) KeyResolver {
+	return func(pairs []Pair) (string, error) {
+		for _, p := range pairs {
+			if p.Key == key {
+				return lookup(p.Value)
+			}
+		}
+		return "", &FieldError{Path: key, Err: errMissingField}
+	}
+}
+
+// resolveKey returns q applying the key resolved from fields.
+func (q *Qsign) resolveKey(ctx context.Context, fields []*field) (*Qsign, error) {
+	secret, err := q.keyResolver(ctx, pairsOf(fields))
+	if err != nil {
+		return nil, err
+	}
+	return q.withKey(Key{Secret: secret}), nil
+}
@@ -0,0 +1,88 @@
+package qsign
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestQsignKeyResolver(t *testing.T) {
+	secrets := map[string]string{
+		"10000100": "192006250b4c09247ec02edce69f6a2d",
+		"10000200": "0f8e3c0b4c09247ec02edce69f6a2d19",
+	}
+
+	var resolved [][]Pair
+	q := NewQsign(Options{
+		KeySuffix: func(secret string) string {
+			return "&key=" + secret
+		},
+		KeyResolver: func(pairs []Pair) (string, error) {
+			resolved = append(resolved, pairs)
+			return KeyByField("mch_id", func(value string) (string, error) {
+				secret, ok := secrets[value]
+				if !ok {
+					return "", errors.New("unknown merchant")
+				}
+				return secret, nil
+			})(pairs)
+		},
+	})
+
+	data := map[string]interface{}{
+		"appid":       "wxd930ea5d5a258f4f",
+		"mch_id":      10000100,
+		"device_info": "1000",
+		"body":        "test",
+		"nonce_str":   "ibuaiVcKdpRxkhJA",
+	}
+
+	signature, err := q.Sign(data)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	if expect := "9a0a8659f005d6984697e2ca0a9cf3b7"; string(signature) != expect {
+		t.Errorf("expect %s, actual %s", expect, signature)
+	}
+
+	expect := []Pair{
+		{"appid", "wxd930ea5d5a258f4f"},
+		{"body", "test"},
+		{"device_info", "1000"},
+		{"mch_id", "10000100"},
+		{"nonce_str", "ibuaiVcKdpRxkhJA"},
+	}
+	if !reflect.DeepEqual(resolved[0], expect) {
+		t.Errorf("expect resolver receives %v, actual %v", expect, resolved[0])
+	}
+
+	if err := q.Verify(data, signature); err != nil {
+		t.Errorf("expect no error, actual %v", err)
+	}
+
+	data["mch_id"] = 10000200
+	if err := q.Verify(data, signature); err != ErrSignatureMismatch {
+		t.Errorf("expect signature mismatch with the key of another merchant, actual %v", err)
+	}
+
+	data["mch_id"] = 10000300
+	if _, err := q.Sign(data); err == nil {
+		t.Errorf("expect error for unknown merchant, actual nil")
+	}
+	if err := q.Verify(data, signature); err == nil {
+		t.Errorf("expect error for unknown merchant, actual nil")
+	}
+
+	delete(data, "mch_id")
+	var fe *FieldError
+	if _, err := q.Sign(data); !errors.As(err, &fe) || fe.Path != "mch_id" {
+		t.Errorf("expect error for missing key field, actual %v", err)
+	}
+
+	if _, err := q.SignBytes([]byte("raw")); err == nil {
+		t.Errorf("expect error resolving key of raw data, actual nil")
+	}
+	if err := q.VerifyBytes([]byte("raw"), signature); err == nil {
+		t.Errorf("expect error resolving key of raw data, actual nil")
+	}
+}
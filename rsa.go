@@ -0,0 +1,76 @@
+package qsign
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+)
+
+type rsaSigner struct {
+	key  *rsa.PrivateKey
+	hash crypto.Hash
+}
+
+// NewRSASigner returns a Signer signing checksums with RSASSA-PKCS1-v1_5. The checksums must
+// be calculated by hash, so the Hasher of Qsign must be hash.New.
+func NewRSASigner(key *rsa.PrivateKey, hash crypto.Hash) Signer {
+	return &rsaSigner{key: key, hash: hash}
+}
+
+func (s *rsaSigner) Sign(sum []byte) ([]byte, error) {
+	return rsa.SignPKCS1v15(rand.Reader, s.key, s.hash, sum)
+}
+
+type rsaVerifier struct {
+	key  *rsa.PublicKey
+	hash crypto.Hash
+}
+
+// NewRSAVerifier returns a Verifier verifying RSASSA-PKCS1-v1_5 signatures. The checksums
+// must be calculated by hash, so the Hasher of Qsign must be hash.New.
+func NewRSAVerifier(key *rsa.PublicKey, hash crypto.Hash) Verifier {
+	return &rsaVerifier{key: key, hash: hash}
+}
+
+func (v *rsaVerifier) Verify(sum, signature []byte) error {
+	if err := rsa.VerifyPKCS1v15(v.key, v.hash, sum, signature); err != nil {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+type rsaPSSSigner struct {
+	key  *rsa.PrivateKey
+	hash crypto.Hash
+}
+
+// NewRSAPSSSigner returns a Signer signing checksums with RSASSA-PSS, using a salt as long as
+// the checksum. The checksums must be calculated by hash, so the Hasher of Qsign must be
+// hash.New.
+func NewRSAPSSSigner(key *rsa.PrivateKey, hash crypto.Hash) Signer {
+	return &rsaPSSSigner{key: key, hash: hash}
+}
+
+func (s *rsaPSSSigner) Sign(sum []byte) ([]byte, error) {
+	return rsa.SignPSS(rand.Reader, s.key, s.hash, sum, &rsa.PSSOptions{
+		SaltLength: rsa.PSSSaltLengthEqualsHash,
+	})
+}
+
+type rsaPSSVerifier struct {
+	key  *rsa.PublicKey
+	hash crypto.Hash
+}
+
+// NewRSAPSSVerifier returns a Verifier verifying RSASSA-PSS signatures with any salt length.
+// The checksums must be calculated by hash, so the Hasher of Qsign must be hash.New.
+func NewRSAPSSVerifier(key *rsa.PublicKey, hash crypto.Hash) Verifier {
+	return &rsaPSSVerifier{key: key, hash: hash}
+}
+
+func (v *rsaPSSVerifier) Verify(sum, signature []byte) error {
+	if err := rsa.VerifyPSS(v.key, v.hash, sum, signature, nil); err != nil {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package qsign
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"sync"
+	"testing"
+)
+
+var (
+	rsaKeyForTestOnce sync.Once
+	rsaKeyForTest     *rsa.PrivateKey
+)
+
+// testRSAKey returns a RSA private key shared by tests.
+func testRSAKey(t *testing.T) *rsa.PrivateKey {
+	rsaKeyForTestOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("expect no error generating RSA key, actual %v", err)
+		}
+		rsaKeyForTest = key
+	})
+	return rsaKeyForTest
+}
+
+func TestRSASignerVerifier(t *testing.T) {
+	key := testRSAKey(t)
+	sum := sha256.Sum256([]byte("appid=wxd930ea5d5a258f4f&body=test"))
+
+	signature, err := NewRSASigner(key, crypto.SHA256).Sign(sum[:])
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], signature); err != nil {
+		t.Errorf("expect signature is PKCS #1 v1.5, actual %v", err)
+	}
+
+	verifier := NewRSAVerifier(&key.PublicKey, crypto.SHA256)
+	if err := verifier.Verify(sum[:], signature); err != nil {
+		t.Errorf("expect signature is valid, actual %v", err)
+	}
+
+	signature[0] ^= 0xff
+	if err := verifier.Verify(sum[:], signature); err != ErrSignatureMismatch {
+		t.Errorf("expect signature mismatch, actual %v", err)
+	}
+}
+
+func TestRSAPSSSignerVerifier(t *testing.T) {
+	key := testRSAKey(t)
+	sum := sha512.Sum512([]byte("appid=wxd930ea5d5a258f4f&body=test"))
+
+	signature, err := NewRSAPSSSigner(key, crypto.SHA512).Sign(sum[:])
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+
+	opts := &rsa.PSSOptions{SaltLength: sha512.Size}
+	if err := rsa.VerifyPSS(&key.PublicKey, crypto.SHA512, sum[:], signature, opts); err != nil {
+		t.Errorf("expect signature is PSS with a 64 bytes salt, actual %v", err)
+	}
+
+	verifier := NewRSAPSSVerifier(&key.PublicKey, crypto.SHA512)
+	if err := verifier.Verify(sum[:], signature); err != nil {
+		t.Errorf("expect signature is valid, actual %v", err)
+	}
+
+	signature[0] ^= 0xff
+	if err := verifier.Verify(sum[:], signature); err != ErrSignatureMismatch {
+		t.Errorf("expect signature mismatch, actual %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+package qsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SigV4Algorithm is the name of the signing algorithm of AWS Signature Version 4.
+	SigV4Algorithm = "AWS4-HMAC-SHA256"
+
+	// UnsignedPayload is used as the payload hash if the payload is not signed.
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+	sigV4TimeFormat = "20060102T150405Z"
+	sigV4DateFormat = "20060102"
+)
+
+// sigV4IgnoredHeaders are headers which may be changed on the way, they are never signed.
+var sigV4IgnoredHeaders = map[string]bool{
+	"authorization":   true,
+	"user-agent":      true,
+	"x-amzn-trace-id": true,
+	"expect":          true,
+	"content-length":  true,
+}
+
+// SigV4Signer signs requests by AWS Signature Version 4, which is used by S3 and S3
+// compatible storages like MinIO, as well as other AWS services.
+type SigV4Signer struct {
+	accessKeyID     string
+	secretAccessKey string
+	region          string
+	service         string
+}
+
+// NewSigV4Signer returns a *SigV4Signer signing requests to service, like "s3", in region
+// with the access key.
+func NewSigV4Signer(accessKeyID, secretAccessKey, region, service string) *SigV4Signer {
+	return &SigV4Signer{
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		region:          region,
+		service:         service,
+	}
+}
+
+// PayloadHash returns the lowercase hex SHA-256 hash of payload, used to sign requests.
+func PayloadHash(payload []byte) string {
+	h, _ := sha256Qsign.SignBytes(payload)
+	return string(h)
+}
+
+// Sign signs req sent at t, setting headers "X-Amz-Date" and "Authorization". For service
+// "s3", header "X-Amz-Content-Sha256" is set to payloadHash as well. payloadHash is the hash
+// returned by PayloadHash, or UnsignedPayload. An empty payloadHash is the hash of an empty
+// payload.
+//
+// Host and all the other headers of req are signed, except for those which may be changed
+// on the way like "User-Agent". For service "s3", paths are escaped once, like S3 does. For
+// other services, the path sent on the wire, which is URL.Opaque if it's given or the escaped
+// path, has "." and ".." segments and duplicate slashes removed, then is escaped again.
+func (s *SigV4Signer) Sign(req *http.Request, payloadHash string, t time.Time) error {
+	if len(payloadHash) == 0 {
+		payloadHash = PayloadHash(nil)
+	}
+
+	amzDate := t.UTC().Format(sigV4TimeFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	signedHeaders := []string{"host"}
+	for k := range req.Header {
+		k = strings.ToLower(k)
+		if !sigV4IgnoredHeaders[k] && k != "host" {
+			signedHeaders = append(signedHeaders, k)
+		}
+	}
+	sort.Strings(signedHeaders)
+
+	signature := s.signature(req, req.URL.Query(), signedHeaders, payloadHash, t)
+
+	req.Header.Set("Authorization", SigV4Algorithm+
+		" Credential="+s.accessKeyID+"/"+s.scope(t)+
+		", SignedHeaders="+strings.Join(signedHeaders, ";")+
+		", Signature="+signature)
+
+	return nil
+}
+
+// Presign returns the presigned URL of req, valid for expires from t. Only the host header is
+// signed and the payload is unsigned.
+func (s *SigV4Signer) Presign(req *http.Request, expires time.Duration, t time.Time) (string, error) {
+	if expires <= 0 || expires > 7*24*time.Hour {
+		return "", errors.New("qsign: presigned URL expires must be in (0, 7 days]")
+	}
+
+	query := req.URL.Query()
+	query.Set("X-Amz-Algorithm", SigV4Algorithm)
+	query.Set("X-Amz-Credential", s.accessKeyID+"/"+s.scope(t))
+	query.Set("X-Amz-Date", t.UTC().Format(sigV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	signature := s.signature(req, query, []string{"host"}, UnsignedPayload, t)
+
+	u := *req.URL
+	u.RawQuery = CanonicalQuery(query) + "&X-Amz-Signature=" + signature
+	if len(u.Host) == 0 {
+		u.Host = req.Host
+	}
+
+	return u.String(), nil
+}
+
+// scope returns the credential scope of date t.
+func (s *SigV4Signer) scope(t time.Time) string {
+	return t.UTC().Format(sigV4DateFormat) + "/" + s.region + "/" + s.service + "/aws4_request"
+}
+
+// signature returns the signature of req sent at t, with query parameters query and headers
+// signedHeaders, which are lowercase and sorted.
+func (s *SigV4Signer) signature(req *http.Request, query url.Values, signedHeaders []string, payloadHash string, t time.Time) string {
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s.canonicalURI(req.URL),
+		CanonicalQuery(query),
+		sigV4CanonicalHeaders(req, signedHeaders),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		SigV4Algorithm,
+		t.UTC().Format(sigV4TimeFormat),
+		s.scope(t),
+		PayloadHash([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), t.UTC().Format(sigV4DateFormat))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+
+	q := NewQsign(Options{
+		Hasher: func() hash.Hash {
+			return hmac.New(sha256.New, key)
+		},
+	})
+	signature, _ := q.SignBytes([]byte(stringToSign))
+
+	return string(signature)
+}
+
+// canonicalURI returns the canonical URI of u. S3 escapes the path once, while other services
+// normalize the path sent on the wire and escape it again.
+func (s *SigV4Signer) canonicalURI(u *url.URL) string {
+	if s.service == "s3" {
+		return sigV4CanonicalURI(u.Path)
+	}
+	return sigV4CanonicalURI(sigV4NormalizePath(sigV4WirePath(u)))
+}
+
+// sigV4WirePath returns the path of u sent in the request line, which is URL.Opaque if it's
+// given, without the scheme and the host, or the escaped path.
+func sigV4WirePath(u *url.URL) string {
+	if len(u.Opaque) == 0 {
+		return u.EscapedPath()
+	}
+
+	p := u.Opaque
+	if strings.HasPrefix(p, "//") {
+		i := strings.IndexByte(p[2:], '/')
+		if i < 0 {
+			return "/"
+		}
+		p = p[2+i:]
+	}
+	return p
+}
+
+// sigV4NormalizePath removes "." and ".." segments and duplicate slashes of p by RFC 3986. Like
+// the remove_dot_segments algorithm, a path ending with a slash or a dot segment keeps a
+// trailing slash.
+func sigV4NormalizePath(p string) string {
+	if len(p) == 0 {
+		return "/"
+	}
+
+	cleaned := path.Clean("/" + p)
+	trailing := strings.HasSuffix(p, "/") || strings.HasSuffix(p, "/.") || strings.HasSuffix(p, "/..")
+	if trailing && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// sigV4CanonicalURI escapes each segment of path by RFC 3986.
+func sigV4CanonicalURI(path string) string {
+	if len(path) == 0 {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = escapeRFC3986(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// sigV4CanonicalHeaders returns the canonical headers of req, including headers signedHeaders.
+// Values are trimmed with sequential spaces squeezed, multiple values are joined by commas.
+func sigV4CanonicalHeaders(req *http.Request, signedHeaders []string) string {
+	var buf strings.Builder
+	for _, k := range signedHeaders {
+		raw := req.Header[http.CanonicalHeaderKey(k)]
+		if k == "host" {
+			raw = []string{req.Host}
+			if len(req.Host) == 0 {
+				raw = []string{req.URL.Host}
+			}
+		}
+
+		values := make([]string, len(raw))
+		for i, v := range raw {
+			values[i] = strings.Join(strings.Fields(v), " ")
+		}
+
+		buf.WriteString(k)
+		buf.WriteByte(':')
+		buf.WriteString(strings.Join(values, ","))
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
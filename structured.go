@@ -0,0 +1,364 @@
+package qsign
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sfToken is a token of structured field values (RFC 8941).
+type sfToken string
+
+// sfItem is an item or an inner list of structured field values. Value is one of string,
+// sfToken, int64, bool, []byte, or []*sfItem for inner lists.
+type sfItem struct {
+	value  interface{}
+	params []sfParam
+}
+
+// sfParam is a parameter of an item or an inner list.
+type sfParam struct {
+	key   string
+	value interface{}
+}
+
+// param returns the value of parameter key.
+func (it *sfItem) param(key string) (interface{}, bool) {
+	for _, p := range it.params {
+		if p.key == key {
+			return p.value, true
+		}
+	}
+	return nil, false
+}
+
+// serialize serializes it as a structured field value.
+func (it *sfItem) serialize() string {
+	var buf strings.Builder
+
+	if list, ok := it.value.([]*sfItem); ok {
+		buf.WriteByte('(')
+		for i, m := range list {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(m.serialize())
+		}
+		buf.WriteByte(')')
+	} else {
+		buf.WriteString(serializeBareItem(it.value))
+	}
+
+	for _, p := range it.params {
+		buf.WriteByte(';')
+		buf.WriteString(p.key)
+		if v, ok := p.value.(bool); ok && v {
+			continue
+		}
+		buf.WriteByte('=')
+		buf.WriteString(serializeBareItem(p.value))
+	}
+
+	return buf.String()
+}
+
+func serializeBareItem(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+	case sfToken:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		if v {
+			return "?1"
+		}
+		return "?0"
+	case []byte:
+		return ":" + base64.StdEncoding.EncodeToString(v) + ":"
+	default:
+		return ""
+	}
+}
+
+// sfParser parses structured field values.
+type sfParser struct {
+	s   string
+	pos int
+}
+
+// parseSFDictionary parses dictionary s, returning its members by key.
+func parseSFDictionary(s string) (map[string]*sfItem, error) {
+	p := &sfParser{s: s}
+	dict := map[string]*sfItem{}
+
+	p.skipSpaces()
+	for !p.eof() {
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+
+		var member *sfItem
+		if p.peek() == '=' {
+			p.pos++
+			if member, err = p.parseItemOrInnerList(); err != nil {
+				return nil, err
+			}
+		} else {
+			params, err := p.parseParams()
+			if err != nil {
+				return nil, err
+			}
+			member = &sfItem{value: true, params: params}
+		}
+		dict[key] = member
+
+		p.skipOWS()
+		if p.eof() {
+			break
+		}
+		if p.peek() != ',' {
+			return nil, p.errorf("expect ','")
+		}
+		p.pos++
+		p.skipOWS()
+		if p.eof() {
+			return nil, p.errorf("trailing ','")
+		}
+	}
+
+	return dict, nil
+}
+
+func (p *sfParser) parseItemOrInnerList() (*sfItem, error) {
+	if p.peek() != '(' {
+		return p.parseItem()
+	}
+
+	p.pos++
+	list := []*sfItem{}
+	for {
+		p.skipSpaces()
+		if p.eof() {
+			return nil, p.errorf("unterminated inner list")
+		}
+		if p.peek() == ')' {
+			p.pos++
+			break
+		}
+
+		item, err := p.parseItem()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+
+		if c := p.peek(); c != ' ' && c != ')' {
+			return nil, p.errorf("expect ' ' or ')'")
+		}
+	}
+
+	params, err := p.parseParams()
+	if err != nil {
+		return nil, err
+	}
+	return &sfItem{value: list, params: params}, nil
+}
+
+func (p *sfParser) parseItem() (*sfItem, error) {
+	v, err := p.parseBareItem()
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := p.parseParams()
+	if err != nil {
+		return nil, err
+	}
+	return &sfItem{value: v, params: params}, nil
+}
+
+func (p *sfParser) parseParams() ([]sfParam, error) {
+	var params []sfParam
+	for p.peek() == ';' {
+		p.pos++
+		p.skipSpaces()
+
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+
+		var v interface{} = true
+		if p.peek() == '=' {
+			p.pos++
+			if v, err = p.parseBareItem(); err != nil {
+				return nil, err
+			}
+		}
+		params = append(params, sfParam{key: key, value: v})
+	}
+	return params, nil
+}
+
+func (p *sfParser) parseBareItem() (interface{}, error) {
+	c := p.peek()
+	switch {
+	case c == '-' || isDigit(c):
+		return p.parseInteger()
+	case c == '"':
+		return p.parseString()
+	case c == ':':
+		return p.parseByteSequence()
+	case c == '?':
+		return p.parseBoolean()
+	case c == '*' || isAlpha(c):
+		return p.parseToken()
+	default:
+		return nil, p.errorf("unexpected character")
+	}
+}
+
+func (p *sfParser) parseInteger() (interface{}, error) {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	for !p.eof() && isDigit(p.peek()) {
+		p.pos++
+	}
+	if p.peek() == '.' {
+		return nil, p.errorf("decimals are not supported")
+	}
+
+	n, err := strconv.ParseInt(p.s[start:p.pos], 10, 64)
+	if err != nil || p.pos-start > 16 {
+		return nil, p.errorf("invalid integer")
+	}
+	return n, nil
+}
+
+func (p *sfParser) parseString() (interface{}, error) {
+	p.pos++
+	var buf strings.Builder
+	for !p.eof() {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case c == '\\':
+			if p.eof() || (p.peek() != '"' && p.peek() != '\\') {
+				return nil, p.errorf("invalid escape")
+			}
+			buf.WriteByte(p.s[p.pos])
+			p.pos++
+		case c == '"':
+			return buf.String(), nil
+		case c < 0x20 || c > 0x7e:
+			return nil, p.errorf("invalid string character")
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return nil, p.errorf("unterminated string")
+}
+
+func (p *sfParser) parseByteSequence() (interface{}, error) {
+	p.pos++
+	end := strings.IndexByte(p.s[p.pos:], ':')
+	if end < 0 {
+		return nil, p.errorf("unterminated byte sequence")
+	}
+
+	b, err := base64.StdEncoding.DecodeString(p.s[p.pos : p.pos+end])
+	if err != nil {
+		return nil, p.errorf("invalid byte sequence")
+	}
+	p.pos += end + 1
+	return b, nil
+}
+
+func (p *sfParser) parseBoolean() (interface{}, error) {
+	p.pos++
+	switch p.peek() {
+	case '1':
+		p.pos++
+		return true, nil
+	case '0':
+		p.pos++
+		return false, nil
+	default:
+		return nil, p.errorf("invalid boolean")
+	}
+}
+
+func (p *sfParser) parseToken() (interface{}, error) {
+	start := p.pos
+	p.pos++
+	for !p.eof() && isTokenChar(p.peek()) {
+		p.pos++
+	}
+	return sfToken(p.s[start:p.pos]), nil
+}
+
+func (p *sfParser) parseKey() (string, error) {
+	c := p.peek()
+	if c != '*' && !('a' <= c && c <= 'z') {
+		return "", p.errorf("invalid key")
+	}
+
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if !('a' <= c && c <= 'z') && !isDigit(c) && c != '_' && c != '-' && c != '.' && c != '*' {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos], nil
+}
+
+func (p *sfParser) skipSpaces() {
+	for p.peek() == ' ' {
+		p.pos++
+	}
+}
+
+func (p *sfParser) skipOWS() {
+	for c := p.peek(); c == ' ' || c == '\t'; c = p.peek() {
+		p.pos++
+	}
+}
+
+func (p *sfParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *sfParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *sfParser) errorf(msg string) error {
+	return fmt.Errorf("qsign: invalid structured field at %d: %s", p.pos, msg)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// isTokenChar checks if c is tchar of RFC 9110, or ':' or '/'.
+func isTokenChar(c byte) bool {
+	if isAlpha(c) || isDigit(c) {
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~:/", c) >= 0
+}
@@ -0,0 +1,96 @@
+package qsign
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSFDictionary(t *testing.T) {
+	cases := []struct {
+		input  string
+		expect map[string]*sfItem
+	}{
+		{``, map[string]*sfItem{}},
+		{`a=1, b=?0`, map[string]*sfItem{
+			"a": {value: int64(1)},
+			"b": {value: false},
+		}},
+		{`a, b;x="y"`, map[string]*sfItem{
+			"a": {value: true},
+			"b": {value: true, params: []sfParam{{key: "x", value: "y"}}},
+		}},
+		{`sig=:AQID:`, map[string]*sfItem{
+			"sig": {value: []byte{1, 2, 3}},
+		}},
+		{`sig1=("@method" "content-digest");created=1618884473;keyid="k\"1";alg=tok/en;v`, map[string]*sfItem{
+			"sig1": {
+				value: []*sfItem{{value: "@method"}, {value: "content-digest"}},
+				params: []sfParam{
+					{key: "created", value: int64(1618884473)},
+					{key: "keyid", value: `k"1`},
+					{key: "alg", value: sfToken("tok/en")},
+					{key: "v", value: true},
+				},
+			},
+		}},
+		{`e=(), n=-42`, map[string]*sfItem{
+			"e": {value: []*sfItem{}},
+			"n": {value: int64(-42)},
+		}},
+	}
+
+	for _, c := range cases {
+		actual, err := parseSFDictionary(c.input)
+		if err != nil {
+			t.Errorf("%s expect no error, actual %v", c.input, err)
+		}
+		if !reflect.DeepEqual(actual, c.expect) {
+			t.Errorf("%s expect %#v, actual %#v", c.input, c.expect, actual)
+		}
+	}
+}
+
+func TestParseSFDictionaryError(t *testing.T) {
+	cases := []string{
+		`A=1`,
+		`a=1,`,
+		`a=1 b=2`,
+		`a=("x"`,
+		`a=("x""y")`,
+		`a="unterminated`,
+		`a="bad\escape"`,
+		`a=:AQID`,
+		`a=:!!:`,
+		`a=?2`,
+		`a=1.5`,
+		`a=12345678901234567`,
+		`a=@`,
+	}
+
+	for _, c := range cases {
+		if _, err := parseSFDictionary(c); err == nil {
+			t.Errorf("%s expect error, actual nil", c)
+		}
+	}
+}
+
+func TestSFItemSerialize(t *testing.T) {
+	cases := []struct {
+		item   *sfItem
+		expect string
+	}{
+		{&sfItem{value: `a "quoted\" string`}, `"a \"quoted\\\" string"`},
+		{&sfItem{value: sfToken("rsa-pss-sha512")}, `rsa-pss-sha512`},
+		{&sfItem{value: []byte{1, 2, 3}, params: []sfParam{{key: "a", value: true}, {key: "b", value: false}}}, `:AQID:;a;b=?0`},
+		{&sfItem{
+			value:  []*sfItem{{value: "@method"}, {value: "@path"}},
+			params: []sfParam{{key: "created", value: int64(1618884473)}, {key: "keyid", value: "test-key"}},
+		}, `("@method" "@path");created=1618884473;keyid="test-key"`},
+	}
+
+	for _, c := range cases {
+		if actual := c.item.serialize(); actual != c.expect {
+			t.Errorf("expect %s, actual %s", c.expect, actual)
+		}
+	}
+}
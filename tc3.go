@@ -0,0 +1,131 @@
+package qsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"hash"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TC3Algorithm is the name of the signing algorithm of Tencent Cloud API v3.
+const TC3Algorithm = "TC3-HMAC-SHA256"
+
+// sha256Qsign hashes raw data by SHA-256, encoded as lowercase hex.
+var sha256Qsign = NewQsign(Options{Hasher: sha256.New})
+
+// TC3Signer signs requests of Tencent Cloud API v3 using TC3-HMAC-SHA256.
+type TC3Signer struct {
+	secretID  string
+	secretKey string
+	service   string
+}
+
+// NewTC3Signer returns a *TC3Signer signing requests to service, like "cvm", with the
+// secret ID and secret key.
+func NewTC3Signer(secretID, secretKey, service string) *TC3Signer {
+	return &TC3Signer{
+		secretID:  secretID,
+		secretKey: secretKey,
+		service:   service,
+	}
+}
+
+// Authorization returns the value of the Authorization header of a request sent at timestamp,
+// which must be sent as header "X-TC-Timestamp" as well.
+//
+// The canonical request is built from method, uri, query, header and payload. The query
+// string is built by CanonicalQuery, which should be used in the request URL as well. All
+// the headers in header are signed, which should include "Content-Type" and "Host".
+func (s *TC3Signer) Authorization(method, uri string, query url.Values, header http.Header, payload []byte, timestamp time.Time) (string, error) {
+	canonicalHeaders, signedHeaders := tc3CanonicalHeaders(header)
+
+	hashedPayload, err := sha256Qsign.SignBytes(payload)
+	if err != nil {
+		return "", err
+	}
+
+	if len(uri) == 0 {
+		uri = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		strings.ToUpper(method),
+		uri,
+		CanonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		string(hashedPayload),
+	}, "\n")
+
+	hashedRequest, err := sha256Qsign.SignBytes([]byte(canonicalRequest))
+	if err != nil {
+		return "", err
+	}
+
+	date := timestamp.UTC().Format("2006-01-02")
+	scope := date + "/" + s.service + "/tc3_request"
+	stringToSign := strings.Join([]string{
+		TC3Algorithm,
+		strconv.FormatInt(timestamp.Unix(), 10),
+		scope,
+		string(hashedRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("TC3"+s.secretKey), date)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "tc3_request")
+
+	q := NewQsign(Options{
+		Hasher: func() hash.Hash {
+			return hmac.New(sha256.New, key)
+		},
+	})
+	signature, err := q.SignBytes([]byte(stringToSign))
+	if err != nil {
+		return "", err
+	}
+
+	return TC3Algorithm + " Credential=" + s.secretID + "/" + scope +
+		", SignedHeaders=" + signedHeaders +
+		", Signature=" + string(signature), nil
+}
+
+// tc3CanonicalHeaders returns the canonical headers and signed headers of header. Keys and
+// values are lowercased and trimmed, multiple values are joined by commas.
+func tc3CanonicalHeaders(header http.Header) (canonical, signed string) {
+	keys := make([]string, 0, len(header))
+	values := make(map[string]string, len(header))
+	for k, vs := range header {
+		k = strings.ToLower(k)
+		keys = append(keys, k)
+
+		trimmed := make([]string, len(vs))
+		for i, v := range vs {
+			trimmed[i] = strings.ToLower(strings.TrimSpace(v))
+		}
+		values[k] = strings.Join(trimmed, ",")
+	}
+	sort.Strings(keys)
+
+	var buf strings.Builder
+	for _, k := range keys {
+		buf.WriteString(k)
+		buf.WriteByte(':')
+		buf.WriteString(values[k])
+		buf.WriteByte('\n')
+	}
+
+	return buf.String(), strings.Join(keys, ";")
+}
+
+// hmacSHA256 returns HMAC-SHA256 of data keyed with key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
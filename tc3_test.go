@@ -0,0 +1,85 @@
+package qsign
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTC3SignerAuthorization(t *testing.T) {
+	timestamp := time.Unix(1551113065, 0)
+
+	// sample from Tencent Cloud API v3 documentation
+	payload := []byte(`{"Limit": 1, "Filters": [{"Values": ["\u672a\u547d\u540d"], "Name": "instance-name"}]}`)
+	header := http.Header{
+		"Content-Type": {"application/json; charset=utf-8"},
+		"Host":         {"cvm.tencentcloudapi.com"},
+	}
+
+	cases := []struct {
+		secretKey string
+		method    string
+		query     url.Values
+		header    http.Header
+		payload   []byte
+		expect    string
+	}{
+		{
+			secretKey: "Gu5t9xGARNpq86cd98joQYCN3EXAMPLE",
+			method:    "POST",
+			header:    header,
+			payload:   payload,
+			expect:    "TC3-HMAC-SHA256 Credential=AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE/2019-02-25/cvm/tc3_request, SignedHeaders=content-type;host, Signature=72e494ea809ad7a8c8f7a4507b9bddcbaa8e581f516e8da2f66e2c5a96525168",
+		},
+		{
+			secretKey: "Gu5t9xGARNpq86cd98joQYCN3*******",
+			method:    "post",
+			header:    header,
+			payload:   payload,
+			expect:    "TC3-HMAC-SHA256 Credential=AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE/2019-02-25/cvm/tc3_request, SignedHeaders=content-type;host, Signature=2230eefd229f582d8b1b891af7107b91597240707d778ab3738f756258d7652c",
+		},
+		{
+			secretKey: "Gu5t9xGARNpq86cd98joQYCN3EXAMPLE",
+			method:    "GET",
+			query: url.Values{
+				"Offset":        {"0"},
+				"Limit":         {"20"},
+				"InstanceIds.0": {"ins-09dx96dg"},
+			},
+			header: http.Header{
+				"Content-Type": {" application/x-www-form-urlencoded "},
+				"Host":         {"CVM.tencentcloudapi.com"},
+			},
+			expect: "TC3-HMAC-SHA256 Credential=AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE/2019-02-25/cvm/tc3_request, SignedHeaders=content-type;host, Signature=6b62e5986abfa5490d77c5b8160f4017047128ff7fe2e799db9c2c8f7f365b78",
+		},
+	}
+
+	for i, c := range cases {
+		s := NewTC3Signer("AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE", c.secretKey, "cvm")
+
+		actual, err := s.Authorization(c.method, "/", c.query, c.header, c.payload, timestamp)
+		if err != nil {
+			t.Errorf("case %d expect no error, actual %v", i, err)
+		}
+		if actual != c.expect {
+			t.Errorf("case %d expect authorization is %s, actual is %s", i, c.expect, actual)
+		}
+	}
+}
+
+func TestTC3CanonicalHeaders(t *testing.T) {
+	canonical, signed := tc3CanonicalHeaders(http.Header{
+		"Host":         {"cvm.tencentcloudapi.com"},
+		"Content-Type": {"application/json; charset=utf-8"},
+		"X-Tc-Action":  {" DescribeInstances "},
+	})
+
+	expect := "content-type:application/json; charset=utf-8\nhost:cvm.tencentcloudapi.com\nx-tc-action:describeinstances\n"
+	if canonical != expect {
+		t.Errorf("expect canonical headers are %q, actual are %q", expect, canonical)
+	}
+	if expect := "content-type;host;x-tc-action"; signed != expect {
+		t.Errorf("expect signed headers are %s, actual are %s", expect, signed)
+	}
+}
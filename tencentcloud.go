@@ -0,0 +1,66 @@
+package qsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Signature methods of Tencent Cloud API v1, given by parameter "SignatureMethod".
+const (
+	TencentCloudHmacSHA1   = "HmacSHA1"
+	TencentCloudHmacSHA256 = "HmacSHA256"
+)
+
+// NewTencentCloudV1 returns a *Qsign signing request parameters of Tencent Cloud API v1 with
+// secret key secretKey. The signed result is the value of parameter "Signature".
+//
+// Parameter "Signature" and parameters with empty values are excluded from the digest, and
+// the request method, host and path are prepended to it, e.g.
+// "GETcvm.tencentcloudapi.com/?Action=DescribeInstances&...". The digest is signed by HMAC
+// keyed with secretKey, using the hash given by parameter "SignatureMethod", which is
+// HmacSHA1 by default, and encoded as base64.
+func NewTencentCloudV1(secretKey, method, host, path string) *Qsign {
+	prefix := strings.ToUpper(method) + host + path + "?"
+
+	q := NewQsign(Options{
+		PrefixGenerator: func() string {
+			return prefix
+		},
+		Filter: func(key, value string) bool {
+			return key != "Signature" && len(value) > 0
+		},
+		Encoder: base64Encoder,
+	})
+
+	q.selectHasher = func(fields []*field) (Hasher, error) {
+		for _, f := range fields {
+			if f.name == "SignatureMethod" {
+				return tencentCloudV1Hasher(secretKey, f.value)
+			}
+		}
+		return tencentCloudV1Hasher(secretKey, TencentCloudHmacSHA1)
+	}
+
+	return q
+}
+
+// tencentCloudV1Hasher returns the Hasher of Tencent Cloud API v1 signature method method.
+func tencentCloudV1Hasher(secretKey, method string) (Hasher, error) {
+	var h func() hash.Hash
+	switch method {
+	case TencentCloudHmacSHA1:
+		h = sha1.New
+	case TencentCloudHmacSHA256:
+		h = sha256.New
+	default:
+		return nil, &FieldError{Path: "SignatureMethod", Err: fmt.Errorf("unsupported Tencent Cloud signature method %q", method)}
+	}
+
+	return func() hash.Hash {
+		return hmac.New(h, []byte(secretKey))
+	}, nil
+}
@@ -0,0 +1,73 @@
+package qsign
+
+import (
+	"testing"
+)
+
+type tencentCloudDescribeInstances struct {
+	Action          string
+	InstanceIds0    string `qsign:"InstanceIds.0"`
+	Limit           int
+	Nonce           int
+	Offset          int
+	Region          string
+	SecretID        string `qsign:"SecretId"`
+	SignatureMethod string
+	Timestamp       int64
+	Version         string
+	Signature       string
+}
+
+func TestTencentCloudV1Sign(t *testing.T) {
+	// sample from Tencent Cloud API v1 documentation
+	req := tencentCloudDescribeInstances{
+		Action:       "DescribeInstances",
+		InstanceIds0: "ins-09dx96dg",
+		Limit:        20,
+		Nonce:        11886,
+		Offset:       0,
+		Region:       "ap-guangzhou",
+		SecretID:     "AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE",
+		Timestamp:    1465185768,
+		Version:      "2017-03-12",
+	}
+
+	q := NewTencentCloudV1("Gu5t9xGARNpq86cd98joQYCN3EXAMPLE", "get", "cvm.tencentcloudapi.com", "/")
+
+	d, err := q.Digest(req)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	expect := "GETcvm.tencentcloudapi.com/?Action=DescribeInstances&InstanceIds.0=ins-09dx96dg&Limit=20&Nonce=11886&Offset=0&Region=ap-guangzhou&SecretId=AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE&Timestamp=1465185768&Version=2017-03-12"
+	if actual := string(d); actual != expect {
+		t.Errorf("expect digest is %s, actual is %s", expect, actual)
+	}
+
+	cases := []struct {
+		method    string
+		signature string
+		expect    string
+	}{
+		{"", "", "EliP9YW3pW28FpsEdkXt/+WcGeI="},
+		{"", "EliP9YW3pW28FpsEdkXt/+WcGeI=", "EliP9YW3pW28FpsEdkXt/+WcGeI="},
+		{TencentCloudHmacSHA256, "", "A8uy2/o7WBZXYCTWEFpMrVGhGBVlEGIOioeqRM+fzFs="},
+	}
+
+	for _, c := range cases {
+		req.SignatureMethod = c.method
+		req.Signature = c.signature
+
+		d, err := q.Sign(req)
+		if err != nil {
+			t.Errorf("expect no error, actual %v", err)
+		}
+		if actual := string(d); actual != c.expect {
+			t.Errorf("expect signature method %q signature is %s, actual is %s", c.method, c.expect, actual)
+		}
+	}
+
+	req.SignatureMethod = "HmacMD5"
+	if _, err := q.Sign(req); err == nil {
+		t.Errorf("expect unsupported signature method returns an error")
+	}
+}
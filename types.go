@@ -1,14 +1,83 @@
 package qsign
 
 import (
+	"context"
 	"crypto/md5"
+	"encoding/base64"
 	"encoding/hex"
 	"hash"
 )
 
+// Pair is a key-value pair of data being signed.
+type Pair struct {
+	Key   string
+	Value string
+}
+
+// pairsOf returns the pairs of fields.
+func pairsOf(fields []*field) []Pair {
+	pairs := make([]Pair, len(fields))
+	for i, f := range fields {
+		pairs[i] = Pair{Key: f.name, Value: f.value}
+	}
+	return pairs
+}
+
 // Generator is function returns string. It's used to generate digest prefix or suffix.
 type Generator func() string
 
+// ContextGenerator is like Generator, but receives the context of signing and may fail, like
+// when it fetches a secret from a vault.
+type ContextGenerator func(ctx context.Context) (string, error)
+
+// PairsGenerator is like ContextGenerator, but receives the pairs being signed as well, so the
+// prefix or suffix can be computed from them, like a hash of them or the number of them.
+// Pairs are filtered and sorted by key, like they're in the digest. For raw data, pairs are
+// empty.
+type PairsGenerator func(ctx context.Context, pairs []Pair) (string, error)
+
+// pairsGenerator adapts g or cg to a PairsGenerator, preferring cg.
+func pairsGenerator(g Generator, cg ContextGenerator) PairsGenerator {
+	switch {
+	case cg != nil:
+		return func(ctx context.Context, _ []Pair) (string, error) {
+			return cg(ctx)
+		}
+	case g != nil:
+		return func(context.Context, []Pair) (string, error) {
+			return g(), nil
+		}
+	default:
+		return nil
+	}
+}
+
+// DigestMode selects how key-value pairs are serialized in the digest.
+type DigestMode int
+
+const (
+	// QueryDigest connects key-value pairs like an HTTP query string, e.g. "a=1&b=2".
+	QueryDigest DigestMode = iota
+
+	// CanonicalJSONDigest serializes key-value pairs as a JSON object by the JSON
+	// Canonicalization Scheme (RFC 8785), e.g. `{"a":1,"b":"2"}`. Numbers and booleans keep
+	// their JSON types, nil pointers, interfaces and map values kept by the filter are null, other
+	// values are strings. Like encoding/json, fields promoted through nil embedded pointers are
+	// omitted.
+	CanonicalJSONDigest
+
+	// EscapedQueryDigest is like QueryDigest, but bytes of the delimiter and the connector, and
+	// "%", are escaped like "%26" in keys and values, so distinct pairs never connect to the
+	// same digest. The delimiter and the connector must not contain "%" or uppercase hex
+	// digits.
+	EscapedQueryDigest
+
+	// LengthPrefixedDigest writes each key and value prefixed by its length in bytes and ":",
+	// e.g. "1:a1:11:b1:2", so distinct pairs never produce the same digest. The delimiter and
+	// the connector are not used.
+	LengthPrefixedDigest
+)
+
 // Filter is function receives a key-value pair, returns bool value. It's used to filter out
 // invalid key-value pair in the digest.
 type Filter func(key, value string) bool
@@ -39,9 +108,40 @@ type Encoding interface {
 	EncodedLen(n int) int
 }
 
+// Decoding is an interface for encoding schemes which can decode signatures. It's required
+// to verify signatures with a Verifier. Both hex and base64 encodings implement it.
+type Decoding interface {
+
+	// Decode decodes src using the encoding, writing at most DecodedLen(len(src)) bytes to dst.
+	// It returns the number of bytes written.
+	Decode(dst, src []byte) (int, error)
+
+	// DecodedLen returns the maximum length in bytes of the decoded data of n bytes of input.
+	DecodedLen(n int) int
+}
+
 // Encoder is a function returns Encoding interface for Qsign to encode digest.
 type Encoder func() Encoding
 
+func base64Encoder() Encoding {
+	return base64.StdEncoding
+}
+
+// Signer signs checksums for asymmetric signing methods, like RSA.
+type Signer interface {
+
+	// Sign signs sum, the checksum of the digest calculated by the hasher.
+	Sign(sum []byte) ([]byte, error)
+}
+
+// Verifier verifies signatures for asymmetric signing methods, like RSA.
+type Verifier interface {
+
+	// Verify checks decoded signature against sum, the checksum of the digest calculated by
+	// the hasher. It returns an error if the signature is invalid.
+	Verify(sum, signature []byte) error
+}
+
 type hexEncoding struct{}
 
 func (h *hexEncoding) Encode(dst, src []byte) {
@@ -52,8 +152,45 @@ func (h *hexEncoding) EncodedLen(n int) int {
 	return hex.EncodedLen(n)
 }
 
+func (h *hexEncoding) Decode(dst, src []byte) (int, error) {
+	return hex.Decode(dst, src)
+}
+
+func (h *hexEncoding) DecodedLen(n int) int {
+	return hex.DecodedLen(n)
+}
+
 var defaultHexEncoding = &hexEncoding{}
 
+// upperHexEncoding is hex encoding using uppercase letters.
+type upperHexEncoding struct{}
+
+func (h *upperHexEncoding) Encode(dst, src []byte) {
+	const hextable = "0123456789ABCDEF"
+	for i, v := range src {
+		dst[i*2] = hextable[v>>4]
+		dst[i*2+1] = hextable[v&0x0f]
+	}
+}
+
+func (h *upperHexEncoding) EncodedLen(n int) int {
+	return hex.EncodedLen(n)
+}
+
+func (h *upperHexEncoding) Decode(dst, src []byte) (int, error) {
+	return hex.Decode(dst, src)
+}
+
+func (h *upperHexEncoding) DecodedLen(n int) int {
+	return hex.DecodedLen(n)
+}
+
+var defaultUpperHexEncoding = &upperHexEncoding{}
+
+func upperHexEncoder() Encoding {
+	return defaultUpperHexEncoding
+}
+
 func defaultEncoder() Encoding {
 	return defaultHexEncoding
 }
@@ -0,0 +1,195 @@
+package qsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultWebhookTolerance is the tolerance of webhook timestamps recommended by Stripe and Slack.
+const DefaultWebhookTolerance = DefaultTolerance
+
+// webhookSecrets signs payloads by HMAC-SHA256 with each secret, encoded as lowercase hex.
+type webhookSecrets []*Qsign
+
+func newWebhookSecrets(secrets []string) webhookSecrets {
+	qs := make(webhookSecrets, len(secrets))
+	for i, secret := range secrets {
+		key := []byte(secret)
+		qs[i] = NewQsign(Options{
+			Hasher: func() hash.Hash {
+				return hmac.New(sha256.New, key)
+			},
+		})
+	}
+	return qs
+}
+
+// verify checks if any of signatures is signed by any of the secrets. Secrets being rotated
+// are accepted, as well as multiple signatures sent while the sender rotates its secret.
+func (s webhookSecrets) verify(payload []byte, signatures []string) error {
+	for _, q := range s {
+		for _, signature := range signatures {
+			if q.VerifyBytes(payload, []byte(signature)) == nil {
+				return nil
+			}
+		}
+	}
+	return ErrSignatureMismatch
+}
+
+// checkWebhookTimestamp checks if timestamp, in Unix seconds, is within tolerance of now. A
+// zero tolerance disables the check. A malformed timestamp is reported as a *FieldError of
+// header key.
+func checkWebhookTimestamp(key, timestamp string, tolerance time.Duration, now time.Time) error {
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return &FieldError{Path: key, Err: fmt.Errorf("invalid timestamp %q", timestamp)}
+	}
+	if tolerance == 0 {
+		return nil
+	}
+	return checkTimestamp(time.Unix(t, 0), tolerance, now)
+}
+
+// GitHubWebhook verifies GitHub webhooks, signed in header "X-Hub-Signature-256" like
+// "sha256=<hex HMAC-SHA256 of the payload>".
+type GitHubWebhook struct {
+	secrets webhookSecrets
+}
+
+// NewGitHubWebhook returns a *GitHubWebhook accepting webhooks signed with any of secrets.
+func NewGitHubWebhook(secrets ...string) *GitHubWebhook {
+	return &GitHubWebhook{secrets: newWebhookSecrets(secrets)}
+}
+
+// Verify verifies payload with header.
+func (w *GitHubWebhook) Verify(header http.Header, payload []byte) error {
+	signature := header.Get("X-Hub-Signature-256")
+	if !strings.HasPrefix(signature, "sha256=") {
+		return fmt.Errorf("%w: missing GitHub webhook signature", ErrSignatureMismatch)
+	}
+	return w.secrets.verify(payload, []string{signature[len("sha256="):]})
+}
+
+// VerifyRequest verifies webhook req. The body is read and restored for reading.
+func (w *GitHubWebhook) VerifyRequest(req *http.Request) error {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return err
+	}
+	return w.Verify(req.Header, body)
+}
+
+// StripeWebhook verifies Stripe webhooks, signed in header "Stripe-Signature" like
+// "t=<timestamp>,v1=<hex HMAC-SHA256 of timestamp.payload>". Other schemes like "v0" are
+// ignored.
+type StripeWebhook struct {
+	secrets   webhookSecrets
+	tolerance time.Duration
+
+	// now is the time timestamps are checked at, replaced in tests.
+	now func() time.Time
+}
+
+// NewStripeWebhook returns a *StripeWebhook accepting webhooks signed with any of secrets
+// within tolerance, like DefaultWebhookTolerance. A zero tolerance accepts any timestamp.
+func NewStripeWebhook(tolerance time.Duration, secrets ...string) *StripeWebhook {
+	return &StripeWebhook{
+		secrets:   newWebhookSecrets(secrets),
+		tolerance: tolerance,
+		now:       time.Now,
+	}
+}
+
+// Verify verifies payload with header.
+func (w *StripeWebhook) Verify(header http.Header, payload []byte) error {
+	var timestamp string
+	var signatures []string
+	for _, item := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signatures = append(signatures, kv[1])
+		}
+	}
+
+	if len(timestamp) == 0 || len(signatures) == 0 {
+		return fmt.Errorf("%w: missing Stripe webhook signature", ErrSignatureMismatch)
+	}
+
+	if err := checkWebhookTimestamp("Stripe-Signature", timestamp, w.tolerance, w.now()); err != nil {
+		return err
+	}
+
+	data := make([]byte, 0, len(timestamp)+1+len(payload))
+	data = append(append(append(data, timestamp...), '.'), payload...)
+	return w.secrets.verify(data, signatures)
+}
+
+// VerifyRequest verifies webhook req. The body is read and restored for reading.
+func (w *StripeWebhook) VerifyRequest(req *http.Request) error {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return err
+	}
+	return w.Verify(req.Header, body)
+}
+
+// SlackWebhook verifies Slack requests, signed in header "X-Slack-Signature" like
+// "v0=<hex HMAC-SHA256 of v0:timestamp:body>", where timestamp is header
+// "X-Slack-Request-Timestamp".
+type SlackWebhook struct {
+	secrets   webhookSecrets
+	tolerance time.Duration
+
+	// now is the time timestamps are checked at, replaced in tests.
+	now func() time.Time
+}
+
+// NewSlackWebhook returns a *SlackWebhook accepting requests signed with any of the signing
+// secrets within tolerance, like DefaultWebhookTolerance. A zero tolerance accepts any
+// timestamp.
+func NewSlackWebhook(tolerance time.Duration, secrets ...string) *SlackWebhook {
+	return &SlackWebhook{
+		secrets:   newWebhookSecrets(secrets),
+		tolerance: tolerance,
+		now:       time.Now,
+	}
+}
+
+// Verify verifies payload with header.
+func (w *SlackWebhook) Verify(header http.Header, payload []byte) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	signature := header.Get("X-Slack-Signature")
+	if len(timestamp) == 0 || !strings.HasPrefix(signature, "v0=") {
+		return fmt.Errorf("%w: missing Slack signature", ErrSignatureMismatch)
+	}
+
+	if err := checkWebhookTimestamp("X-Slack-Request-Timestamp", timestamp, w.tolerance, w.now()); err != nil {
+		return err
+	}
+
+	data := make([]byte, 0, 4+len(timestamp)+len(payload))
+	data = append(append(append(append(data, "v0:"...), timestamp...), ':'), payload...)
+	return w.secrets.verify(data, []string{signature[len("v0="):]})
+}
+
+// VerifyRequest verifies req. The body is read and restored for reading.
+func (w *SlackWebhook) VerifyRequest(req *http.Request) error {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return err
+	}
+	return w.Verify(req.Header, body)
+}
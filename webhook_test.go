@@ -0,0 +1,132 @@
+package qsign
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGitHubWebhook(t *testing.T) {
+	// sample from GitHub docs, "Validating webhook deliveries"
+	header := http.Header{}
+	header.Set("X-Hub-Signature-256", "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17")
+	payload := []byte("Hello, World!")
+
+	cases := []struct {
+		name    string
+		secrets []string
+		payload []byte
+		expect  bool
+	}{
+		{"valid", []string{"It's a Secret to Everybody"}, payload, true},
+		{"rotated", []string{"new secret", "It's a Secret to Everybody"}, payload, true},
+		{"wrong secret", []string{"new secret"}, payload, false},
+		{"tampered", []string{"It's a Secret to Everybody"}, []byte("Hello, World?"), false},
+	}
+
+	for _, c := range cases {
+		err := NewGitHubWebhook(c.secrets...).Verify(header, c.payload)
+		if c.expect && err != nil {
+			t.Errorf("%s expect no error, actual %v", c.name, err)
+		}
+		if !c.expect && err != ErrSignatureMismatch {
+			t.Errorf("%s expect signature mismatch, actual %v", c.name, err)
+		}
+	}
+
+	if err := NewGitHubWebhook("It's a Secret to Everybody").Verify(http.Header{}, payload); !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("expect signature mismatch for missing signature, actual %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "https://example.com/webhook", strings.NewReader("Hello, World!"))
+	req.Header = header
+	if err := NewGitHubWebhook("It's a Secret to Everybody").VerifyRequest(req); err != nil {
+		t.Errorf("expect no error, actual %v", err)
+	}
+	if b, _ := ioutil.ReadAll(req.Body); string(b) != "Hello, World!" {
+		t.Errorf("expect body is restored, actual %s", b)
+	}
+}
+
+func TestStripeWebhook(t *testing.T) {
+	payload := []byte(`{"id": "evt_test_webhook", "object": "event"}`)
+	signature := "c137b1b62277d523cf8fed4dfbd0170a9a5b8a380e00cc3711d4bf0652f2ce7a"
+	timestamp := time.Unix(1492774577, 0)
+
+	cases := []struct {
+		name   string
+		header string
+		at     time.Time
+		valid  bool
+		expect error
+	}{
+		{"valid", "t=1492774577,v1=" + signature, timestamp, true, nil},
+		{"multiple signatures", "t=1492774577,v1=00ff,v1=" + signature + ",v0=00ff", timestamp, true, nil},
+		{"within tolerance", "t=1492774577, v1=" + signature, timestamp.Add(5 * time.Minute), true, nil},
+		{"too old", "t=1492774577,v1=" + signature, timestamp.Add(6 * time.Minute), false, ErrExpired},
+		{"too new", "t=1492774577,v1=" + signature, timestamp.Add(-6 * time.Minute), false, ErrExpired},
+		{"wrong timestamp", "t=1492774578,v1=" + signature, timestamp, false, ErrSignatureMismatch},
+		{"v0 only", "t=1492774577,v0=" + signature, timestamp, false, ErrSignatureMismatch},
+		{"no timestamp", "v1=" + signature, timestamp, false, ErrSignatureMismatch},
+		{"invalid timestamp", "t=now,v1=" + signature, timestamp, false, nil},
+	}
+
+	for _, c := range cases {
+		w := NewStripeWebhook(DefaultWebhookTolerance, "whsec_old", "whsec_test_secret")
+		w.now = func() time.Time { return c.at }
+
+		header := http.Header{}
+		header.Set("Stripe-Signature", c.header)
+		err := w.Verify(header, payload)
+
+		if c.valid && err != nil {
+			t.Errorf("%s expect no error, actual %v", c.name, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%s expect error, actual nil", c.name)
+		}
+		if c.expect != nil && !errors.Is(err, c.expect) {
+			t.Errorf("%s expect %v, actual %v", c.name, c.expect, err)
+		}
+	}
+
+	w := NewStripeWebhook(0, "whsec_test_secret")
+	header := http.Header{}
+	header.Set("Stripe-Signature", "t=1492774577,v1="+signature)
+	if err := w.Verify(header, payload); err != nil {
+		t.Errorf("expect no error without tolerance, actual %v", err)
+	}
+}
+
+func TestSlackWebhook(t *testing.T) {
+	// sample from Slack docs, "Verifying requests from Slack"
+	body := "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+	req, _ := http.NewRequest("POST", "https://example.com/slack/commands", strings.NewReader(body))
+	req.Header.Set("X-Slack-Request-Timestamp", "1531420618")
+	req.Header.Set("X-Slack-Signature", "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503")
+
+	w := NewSlackWebhook(DefaultWebhookTolerance, "8f742231b10e8888abcd99yyyzzz85a5")
+	w.now = func() time.Time { return time.Unix(1531420700, 0) }
+	if err := w.VerifyRequest(req); err != nil {
+		t.Errorf("expect no error, actual %v", err)
+	}
+	if b, _ := ioutil.ReadAll(req.Body); string(b) != body {
+		t.Errorf("expect body is restored, actual %s", b)
+	}
+
+	if err := w.Verify(req.Header, []byte(body+"&x=1")); err != ErrSignatureMismatch {
+		t.Errorf("expect signature mismatch, actual %v", err)
+	}
+
+	w.now = func() time.Time { return time.Unix(1531420618, 0).Add(time.Hour) }
+	if err := w.Verify(req.Header, []byte(body)); err != ErrExpired {
+		t.Errorf("expect timestamp error, actual %v", err)
+	}
+
+	if err := w.Verify(http.Header{}, []byte(body)); !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("expect signature mismatch for missing signature, actual %v", err)
+	}
+}
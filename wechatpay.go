@@ -0,0 +1,57 @@
+package qsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+)
+
+// Sign types of WeChat Pay v2 APIs, given by parameter "sign_type".
+const (
+	WechatPaySignTypeMD5        = "MD5"
+	WechatPaySignTypeHMACSHA256 = "HMAC-SHA256"
+)
+
+// NewWechatPayV2 returns a *Qsign signing parameters of WeChat Pay v2 APIs with API key
+// apiKey.
+//
+// Parameter "sign" and parameters with empty values are excluded from the digest, and
+// "&key=<apiKey>" is appended to it. The checksum is calculated by MD5, or by HMAC-SHA256
+// keyed with apiKey if parameter "sign_type" is "HMAC-SHA256", and encoded as uppercase hex.
+func NewWechatPayV2(apiKey string) *Qsign {
+	q := NewQsign(Options{
+		SuffixGenerator: func() string {
+			return "&key=" + apiKey
+		},
+		Filter: func(key, value string) bool {
+			return key != "sign" && len(value) > 0
+		},
+		Encoder: upperHexEncoder,
+	})
+
+	q.selectHasher = func(fields []*field) (Hasher, error) {
+		for _, f := range fields {
+			if f.name == "sign_type" {
+				return wechatPayV2Hasher(apiKey, f.value)
+			}
+		}
+		return defaultHasher, nil
+	}
+
+	return q
+}
+
+// wechatPayV2Hasher returns the Hasher of WeChat Pay v2 sign type signType.
+func wechatPayV2Hasher(apiKey, signType string) (Hasher, error) {
+	switch signType {
+	case WechatPaySignTypeMD5:
+		return defaultHasher, nil
+	case WechatPaySignTypeHMACSHA256:
+		return func() hash.Hash {
+			return hmac.New(sha256.New, []byte(apiKey))
+		}, nil
+	default:
+		return nil, &FieldError{Path: "sign_type", Err: fmt.Errorf("unsupported WeChat Pay sign type %q", signType)}
+	}
+}
@@ -0,0 +1,108 @@
+package qsign
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+type wechatPayV2Order struct {
+	AppID      string `xml:"appid"`
+	MchID      int    `xml:"mch_id"`
+	DeviceInfo string `xml:"device_info"`
+	Body       string `xml:"body"`
+	NonceStr   string `xml:"nonce_str"`
+	SignType   string `xml:"sign_type,omitempty"`
+	Sign       string `xml:"sign,omitempty"`
+}
+
+const wechatPayV2APIKey = "192006250b4c09247ec02edce69f6a2d"
+
+func TestWechatPayV2Sign(t *testing.T) {
+	// sample from WeChat Pay v2 documentation
+	order := wechatPayV2Order{
+		AppID:      "wxd930ea5d5a258f4f",
+		MchID:      10000100,
+		DeviceInfo: "1000",
+		Body:       "test",
+		NonceStr:   "ibuaiVcKdpRxkhJA",
+	}
+
+	cases := []struct {
+		signType string
+		sign     string
+		expect   string
+	}{
+		{"", "", "9A0A8659F005D6984697E2CA0A9CF3B7"},
+		{"", "9A0A8659F005D6984697E2CA0A9CF3B7", "9A0A8659F005D6984697E2CA0A9CF3B7"},
+		{WechatPaySignTypeMD5, "", "6B4978B16793D0C2604CD59C47425A27"},
+		{WechatPaySignTypeHMACSHA256, "", "2C9DF1156522C0B2B03B4DBF3BCA5CACB602CBD5CA0F9E112458CF3E9855303B"},
+	}
+
+	q := NewWechatPayV2(wechatPayV2APIKey)
+	for _, c := range cases {
+		order.SignType = c.signType
+		order.Sign = c.sign
+
+		d, err := q.Sign(order)
+		if err != nil {
+			t.Errorf("expect no error, actual %v", err)
+		}
+		if actual := string(d); actual != c.expect {
+			t.Errorf("expect sign type %q signature is %s, actual is %s", c.signType, c.expect, actual)
+		}
+	}
+
+	order.SignType = "SHA1"
+	if _, err := q.Sign(order); err == nil {
+		t.Errorf("expect unsupported sign type returns an error")
+	}
+}
+
+func TestWechatPayV2WithHasher(t *testing.T) {
+	order := wechatPayV2Order{
+		AppID:    "wxd930ea5d5a258f4f",
+		MchID:    10000100,
+		NonceStr: "ibuaiVcKdpRxkhJA",
+		SignType: WechatPaySignTypeHMACSHA256,
+	}
+
+	q := NewWechatPayV2(wechatPayV2APIKey).WithHasher(sha256.New)
+	digest, _ := q.Digest(order)
+	sum := sha256.Sum256(digest)
+
+	d, err := q.Sign(order)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	if expect := strings.ToUpper(hex.EncodeToString(sum[:])); string(d) != expect {
+		t.Errorf("expect signed by the given hasher %s, actual is %s", expect, d)
+	}
+}
+
+func TestWechatPayV2Hasher(t *testing.T) {
+	// stringSignTemp and signatures from WeChat Pay v2 documentation
+	digest := "appid=wxd930ea5d5a258f4f&body=test&device_info=1000&mch_id=10000100&nonce_str=ibuaiVcKdpRxkhJA&key=192006250b4c09247ec02edce69f6a2d"
+
+	cases := []struct {
+		signType string
+		expect   string
+	}{
+		{WechatPaySignTypeMD5, "9A0A8659F005D6984697E2CA0A9CF3B7"},
+		{WechatPaySignTypeHMACSHA256, "6A9AE1657590FD6257D693A078E1C3E4BB6BA4DC30B23E0EE2496E54170DACD6"},
+	}
+
+	for _, c := range cases {
+		hasher, err := wechatPayV2Hasher(wechatPayV2APIKey, c.signType)
+		if err != nil {
+			t.Fatalf("expect no error, actual %v", err)
+		}
+
+		h := hasher()
+		h.Write([]byte(digest))
+		if actual := strings.ToUpper(hex.EncodeToString(h.Sum(nil))); actual != c.expect {
+			t.Errorf("expect sign type %q signature is %s, actual is %s", c.signType, c.expect, actual)
+		}
+	}
+}
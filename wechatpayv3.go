@@ -0,0 +1,248 @@
+package qsign
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// WechatPayV3Schema is the authentication schema of WeChat Pay v3 APIs.
+	WechatPayV3Schema = "WECHATPAY2-SHA256-RSA2048"
+
+	// WechatPayV3ResourceAlgorithm is the algorithm encrypting resources of WeChat Pay v3 notifies.
+	WechatPayV3ResourceAlgorithm = "AEAD_AES_256_GCM"
+)
+
+// WechatPayCertStore stores WeChat Pay platform certificates.
+type WechatPayCertStore interface {
+	// Certificate returns the certificate with serial number serial, in hex like header
+	// "Wechatpay-Serial", which is fixed-width and may have leading zeros.
+	Certificate(serial string) (*x509.Certificate, error)
+}
+
+// WechatPayCerts is a WechatPayCertStore in memory. It's safe for concurrent use.
+type WechatPayCerts struct {
+	mu    sync.RWMutex
+	certs map[string]*x509.Certificate
+}
+
+// NewWechatPayCerts returns a *WechatPayCerts storing certs.
+func NewWechatPayCerts(certs ...*x509.Certificate) *WechatPayCerts {
+	s := &WechatPayCerts{certs: map[string]*x509.Certificate{}}
+	s.Add(certs...)
+	return s
+}
+
+// Add adds certs to s, replacing those with the same serial numbers.
+func (s *WechatPayCerts) Add(certs ...*x509.Certificate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, cert := range certs {
+		s.certs[wechatPaySerial(cert.SerialNumber)] = cert
+	}
+}
+
+// Certificate returns the certificate with serial number serial.
+func (s *WechatPayCerts) Certificate(serial string) (*x509.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var cert *x509.Certificate
+	if n, ok := new(big.Int).SetString(serial, 16); ok {
+		cert = s.certs[wechatPaySerial(n)]
+	}
+	if cert == nil {
+		return nil, fmt.Errorf("qsign: unknown WeChat Pay certificate %s", serial)
+	}
+	return cert, nil
+}
+
+// wechatPaySerial formats serial number n as uppercase hex without leading zeros.
+func wechatPaySerial(n *big.Int) string {
+	return fmt.Sprintf("%X", n)
+}
+
+// WechatPayV3 signs requests of WeChat Pay v3 APIs with the merchant private key, and verifies
+// responses and notifies with platform certificates.
+type WechatPayV3 struct {
+	mchID    string
+	serialNo string
+	q        *Qsign
+	certs    WechatPayCertStore
+
+	// now and nonce generate the timestamp and the nonce of requests, replaced in tests.
+	now   func() time.Time
+	nonce func() (string, error)
+}
+
+// NewWechatPayV3 returns a *WechatPayV3 of merchant mchID, signing requests with key, whose
+// certificate has serial number serialNo. Signatures of responses and notifies are verified
+// with certificates from certs, which must not be nil to verify.
+func NewWechatPayV3(mchID, serialNo string, key *rsa.PrivateKey, certs WechatPayCertStore) *WechatPayV3 {
+	return &WechatPayV3{
+		mchID:    mchID,
+		serialNo: serialNo,
+		q: NewQsign(Options{
+			Hasher:  sha256.New,
+			Encoder: base64Encoder,
+			Signer:  NewRSASigner(key, crypto.SHA256),
+		}),
+		certs: certs,
+		now:   time.Now,
+		nonce: randomHex,
+	}
+}
+
+// Sign sets the "Authorization" header of req. The body is read and restored for sending.
+func (w *WechatPayV3) Sign(req *http.Request) error {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := w.Authorization(req.Method, req.URL.RequestURI(), body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", authorization)
+	return nil
+}
+
+// Authorization returns the value of the "Authorization" header of a request to uri, which is
+// the path with the query, like "/v3/certificates". The message to sign is
+// "METHOD\nURI\ntimestamp\nnonce\nbody\n".
+func (w *WechatPayV3) Authorization(method, uri string, body []byte) (string, error) {
+	nonce, err := w.nonce()
+	if err != nil {
+		return "", err
+	}
+	timestamp := strconv.FormatInt(w.now().Unix(), 10)
+
+	message := wechatPayV3Message(method, uri, timestamp, nonce, string(body))
+	signature, err := w.q.SignBytes([]byte(message))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(`%s mchid="%s",nonce_str="%s",signature="%s",timestamp="%s",serial_no="%s"`,
+		WechatPayV3Schema, w.mchID, nonce, signature, timestamp, w.serialNo), nil
+}
+
+// VerifyResponse verifies the signature of resp. The body is read and restored for reading.
+func (w *WechatPayV3) VerifyResponse(resp *http.Response) error {
+	body, err := readBody(&resp.Body)
+	if err != nil {
+		return err
+	}
+	return w.Verify(resp.Header, body)
+}
+
+// VerifyNotify verifies the signature of notify req. The body is read and restored for
+// reading.
+func (w *WechatPayV3) VerifyNotify(req *http.Request) error {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return err
+	}
+	return w.Verify(req.Header, body)
+}
+
+// Verify verifies the signature of a response or a notify with header and body. The message
+// signed with the platform certificate "Wechatpay-Serial" is "timestamp\nnonce\nbody\n", where
+// timestamp and nonce are headers "Wechatpay-Timestamp" and "Wechatpay-Nonce". Like WeChat Pay
+// requires, ErrExpired is returned if the timestamp is more than DefaultTolerance off.
+func (w *WechatPayV3) Verify(header http.Header, body []byte) error {
+	if w.certs == nil {
+		return errors.New("qsign: no WeChat Pay certificates to verify with")
+	}
+
+	serial := header.Get("Wechatpay-Serial")
+	signature := header.Get("Wechatpay-Signature")
+	timestamp := header.Get("Wechatpay-Timestamp")
+	if len(serial) == 0 || len(signature) == 0 || len(timestamp) == 0 {
+		return fmt.Errorf("%w: missing WeChat Pay signature headers", ErrSignatureMismatch)
+	}
+
+	now := w.now()
+	if err := checkWebhookTimestamp("Wechatpay-Timestamp", timestamp, DefaultTolerance, now); err != nil {
+		return err
+	}
+
+	cert, err := w.certs.Certificate(serial)
+	if err != nil {
+		return err
+	}
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("%w: WeChat Pay certificate %s is not valid at %s", ErrInactiveKey, serial, now.Format(time.RFC3339))
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("qsign: WeChat Pay certificate %s has no RSA public key", serial)
+	}
+
+	q := NewQsign(Options{
+		Hasher:   sha256.New,
+		Encoder:  base64Encoder,
+		Verifier: NewRSAVerifier(pub, crypto.SHA256),
+	})
+
+	message := wechatPayV3Message(timestamp, header.Get("Wechatpay-Nonce"), string(body))
+	return q.VerifyBytes([]byte(message), []byte(signature))
+}
+
+// WechatPayV3Resource is the encrypted resource of WeChat Pay v3 notifies.
+type WechatPayV3Resource struct {
+	Algorithm      string `json:"algorithm"`
+	Ciphertext     string `json:"ciphertext"`
+	AssociatedData string `json:"associated_data"`
+	Nonce          string `json:"nonce"`
+	OriginalType   string `json:"original_type"`
+}
+
+// DecryptWechatPayV3Resource decrypts resource with the 32 bytes API v3 key apiV3Key, using
+// AES-256-GCM.
+func DecryptWechatPayV3Resource(apiV3Key string, resource WechatPayV3Resource) ([]byte, error) {
+	if resource.Algorithm != WechatPayV3ResourceAlgorithm {
+		return nil, fmt.Errorf("qsign: unsupported WeChat Pay resource algorithm %q", resource.Algorithm)
+	}
+
+	if len(apiV3Key) != 32 {
+		return nil, errors.New("qsign: WeChat Pay API v3 key must be 32 bytes")
+	}
+
+	block, err := aes.NewCipher([]byte(apiV3Key))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(resource.Nonce))
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(resource.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Open(nil, []byte(resource.Nonce), ciphertext, []byte(resource.AssociatedData))
+}
+
+// wechatPayV3Message joins lines, each followed by "\n".
+func wechatPayV3Message(lines ...string) string {
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,227 @@
+package qsign
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newWechatPayCertForTest returns a self-signed certificate of key with serial number serial.
+func newWechatPayCertForTest(t *testing.T, key *rsa.PrivateKey, serial string, notAfter time.Time) *x509.Certificate {
+	n, _ := new(big.Int).SetString(serial, 16)
+	template := &x509.Certificate{
+		SerialNumber: n,
+		Subject:      pkix.Name{CommonName: "Tenpay.com Root CA"},
+		NotBefore:    time.Unix(1500000000, 0),
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("expect no error creating certificate, actual %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("expect no error parsing certificate, actual %v", err)
+	}
+	return cert
+}
+
+func TestWechatPayV3Sign(t *testing.T) {
+	key := testRSAKey(t)
+	w := NewWechatPayV3("1900009191", "1DDE55AD98ED71D6EDD4A4A16996DE7B47773A8C", key, NewWechatPayCerts())
+	w.now = func() time.Time { return time.Unix(1554208460, 0) }
+	w.nonce = func() (string, error) { return "593BEC0C930BF1AFEB40B4A08C8FB242", nil }
+
+	body := `{"appid":"wxd678efh567hg6787","mchid":"1900009191"}`
+	req, _ := http.NewRequest("POST", "https://api.mch.weixin.qq.com/v3/pay/transactions/jsapi?a=1", strings.NewReader(body))
+	if err := w.Sign(req); err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+
+	authorization := req.Header.Get("Authorization")
+	pattern := regexp.MustCompile(`^WECHATPAY2-SHA256-RSA2048 mchid="1900009191",nonce_str="593BEC0C930BF1AFEB40B4A08C8FB242",signature="([^"]+)",timestamp="1554208460",serial_no="1DDE55AD98ED71D6EDD4A4A16996DE7B47773A8C"$`)
+	matches := pattern.FindStringSubmatch(authorization)
+	if matches == nil {
+		t.Fatalf("expect authorization matches %s, actual %s", pattern, authorization)
+	}
+
+	signature, _ := base64.StdEncoding.DecodeString(matches[1])
+	message := "POST\n/v3/pay/transactions/jsapi?a=1\n1554208460\n593BEC0C930BF1AFEB40B4A08C8FB242\n" + body + "\n"
+	sum := sha256.Sum256([]byte(message))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], signature); err != nil {
+		t.Errorf("expect signature of %q, actual %v", message, err)
+	}
+
+	if b, _ := ioutil.ReadAll(req.Body); string(b) != body {
+		t.Errorf("expect body is restored, actual %s", b)
+	}
+
+	req, _ = http.NewRequest("GET", "https://api.mch.weixin.qq.com/v3/certificates", nil)
+	if err := w.Sign(req); err != nil {
+		t.Errorf("expect no error for empty body, actual %v", err)
+	}
+}
+
+func TestWechatPayV3Verify(t *testing.T) {
+	key := testRSAKey(t)
+	serial := "5157F09EFDC096DE15EBE81A47057A7232F1B8E1"
+	cert := newWechatPayCertForTest(t, key, serial, time.Unix(1900000000, 0))
+	w := NewWechatPayV3("1900009191", "1DDE55AD98ED71D6EDD4A4A16996DE7B47773A8C", key, NewWechatPayCerts(cert))
+	w.now = func() time.Time { return time.Unix(1554209980, 0) }
+
+	body := `{"code_url":"weixin://wxpay/bizpayurl?pr=p4lpSuKzz"}`
+	sum := sha256.Sum256([]byte("1554209980\nc5ac7061fccab6bf3e254dcf98995b8c\n" + body + "\n"))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+
+	header := http.Header{}
+	header.Set("Wechatpay-Serial", strings.ToLower(serial))
+	header.Set("Wechatpay-Timestamp", "1554209980")
+	header.Set("Wechatpay-Nonce", "c5ac7061fccab6bf3e254dcf98995b8c")
+	header.Set("Wechatpay-Signature", base64.StdEncoding.EncodeToString(signature))
+
+	resp := &http.Response{Header: header, Body: ioutil.NopCloser(strings.NewReader(body))}
+	if err := w.VerifyResponse(resp); err != nil {
+		t.Errorf("expect no error, actual %v", err)
+	}
+	if b, _ := ioutil.ReadAll(resp.Body); string(b) != body {
+		t.Errorf("expect body is restored, actual %s", b)
+	}
+
+	req, _ := http.NewRequest("POST", "https://example.com/notify", strings.NewReader(body))
+	req.Header = header
+	if err := w.VerifyNotify(req); err != nil {
+		t.Errorf("expect no error, actual %v", err)
+	}
+
+	if err := w.Verify(header, []byte(body+" ")); err != ErrSignatureMismatch {
+		t.Errorf("expect signature mismatch, actual %v", err)
+	}
+
+	unknown := http.Header{}
+	for k, v := range header {
+		unknown[k] = v
+	}
+	unknown.Set("Wechatpay-Serial", "1DDE55AD98ED71D6EDD4A4A16996DE7B47773A8C")
+	if err := w.Verify(unknown, []byte(body)); err == nil {
+		t.Errorf("expect error for unknown certificate, actual nil")
+	}
+
+	if err := w.Verify(http.Header{}, []byte(body)); !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("expect signature mismatch for missing headers, actual %v", err)
+	}
+
+	for _, at := range []int64{1554209980 - 301, 1554209980 + 301} {
+		w.now = func() time.Time { return time.Unix(at, 0) }
+		if err := w.Verify(header, []byte(body)); err != ErrExpired {
+			t.Errorf("expect timestamp %d off is expired, actual %v", at-1554209980, err)
+		}
+	}
+
+	malformed := http.Header{}
+	for k, v := range header {
+		malformed[k] = v
+	}
+	malformed.Set("Wechatpay-Timestamp", "now")
+	var fe *FieldError
+	if err := w.Verify(malformed, []byte(body)); !errors.As(err, &fe) || fe.Path != "Wechatpay-Timestamp" {
+		t.Errorf("expect field error of malformed timestamp, actual %v", err)
+	}
+
+	w.now = func() time.Time { return time.Unix(1900000001, 0) }
+	malformed.Set("Wechatpay-Timestamp", "1900000001")
+	if err := w.Verify(malformed, []byte(body)); !errors.Is(err, ErrInactiveKey) {
+		t.Errorf("expect inactive key for expired certificate, actual %v", err)
+	}
+
+	w = NewWechatPayV3("1900009191", "1DDE55AD98ED71D6EDD4A4A16996DE7B47773A8C", key, nil)
+	if err := w.Verify(header, []byte(body)); err == nil {
+		t.Errorf("expect error for nil certificate store, actual nil")
+	}
+}
+
+func TestWechatPayCerts(t *testing.T) {
+	key := testRSAKey(t)
+	cert := newWechatPayCertForTest(t, key, "0A1B2C3D4E5F60718293A4B5C6D7E8F901234567", time.Unix(1900000000, 0))
+	certs := NewWechatPayCerts(cert)
+
+	cases := []struct {
+		serial string
+		found  bool
+	}{
+		{"0A1B2C3D4E5F60718293A4B5C6D7E8F901234567", true},
+		{"0a1b2c3d4e5f60718293a4b5c6d7e8f901234567", true},
+		{"A1B2C3D4E5F60718293A4B5C6D7E8F901234567", true},
+		{"1A1B2C3D4E5F60718293A4B5C6D7E8F901234567", false},
+		{"not hex", false},
+		{"", false},
+	}
+
+	for _, c := range cases {
+		actual, err := certs.Certificate(c.serial)
+		if c.found && (err != nil || actual != cert) {
+			t.Errorf("expect certificate %s is found, actual %v", c.serial, err)
+		}
+		if !c.found && err == nil {
+			t.Errorf("expect certificate %s is unknown", c.serial)
+		}
+	}
+}
+
+func TestDecryptWechatPayV3Resource(t *testing.T) {
+	apiV3Key := "0123456789abcdef0123456789abcdef"
+	plaintext := `{"mchid":"1900009191","out_trade_no":"1217752501201407033233368018","trade_state":"SUCCESS"}`
+
+	block, _ := aes.NewCipher([]byte(apiV3Key))
+	gcm, _ := cipher.NewGCM(block)
+	ciphertext := gcm.Seal(nil, []byte("fdasflkja484"), []byte(plaintext), []byte("transaction"))
+
+	resource := WechatPayV3Resource{
+		Algorithm:      WechatPayV3ResourceAlgorithm,
+		Ciphertext:     base64.StdEncoding.EncodeToString(ciphertext),
+		AssociatedData: "transaction",
+		Nonce:          "fdasflkja484",
+		OriginalType:   "transaction",
+	}
+
+	actual, err := DecryptWechatPayV3Resource(apiV3Key, resource)
+	if err != nil {
+		t.Fatalf("expect no error, actual %v", err)
+	}
+	if string(actual) != plaintext {
+		t.Errorf("expect %s, actual %s", plaintext, actual)
+	}
+
+	cases := []struct {
+		name     string
+		key      string
+		modifier func(r *WechatPayV3Resource)
+	}{
+		{"key length", "short", func(r *WechatPayV3Resource) {}},
+		{"algorithm", apiV3Key, func(r *WechatPayV3Resource) { r.Algorithm = "AEAD_AES_128_GCM" }},
+		{"associated data", apiV3Key, func(r *WechatPayV3Resource) { r.AssociatedData = "refund" }},
+		{"ciphertext", apiV3Key, func(r *WechatPayV3Resource) { r.Ciphertext = "!" }},
+		{"nonce", apiV3Key, func(r *WechatPayV3Resource) { r.Nonce = "" }},
+	}
+	for _, c := range cases {
+		r := resource
+		c.modifier(&r)
+		if _, err := DecryptWechatPayV3Resource(c.key, r); err == nil {
+			t.Errorf("%s expect error, actual nil", c.name)
+		}
+	}
+}